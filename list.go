@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dpw/vendetta/vendetta"
+)
+
+// Print the submodules under vendor/, saying whether each is already
+// vendored, would be added, or is unused, and whether it is only
+// needed by tests.  This is the output of -list mode.
+func listSubmodules(out io.Writer, res vendetta.Result) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tDIRECTORY\tSTATUS")
+	for _, sm := range res.Submodules {
+		status := "vendored"
+		switch {
+		case sm.Pending:
+			status = "missing"
+		case !sm.Used:
+			status = "unused"
+		}
+
+		if sm.TestOnly {
+			status += " (tests only)"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", sm.Package, sm.Dir, status)
+	}
+
+	return w.Flush()
+}
+
+// Print just the changes to the submodules under vendor/ that the
+// project needs: "+" for those that would be added, and "-" for those
+// that are no longer used.  This is the output of -diff-only mode.
+func listChanges(out io.Writer, res vendetta.Result) error {
+	changed := false
+	for _, sm := range res.Submodules {
+		switch {
+		case sm.Pending:
+			fmt.Fprintf(out, "+ %s\n", sm.Package)
+		case !sm.Used:
+			fmt.Fprintf(out, "- %s\n", sm.Package)
+		default:
+			continue
+		}
+
+		changed = true
+	}
+
+	if !changed {
+		_, err := fmt.Fprintln(out, "No changes to the dependencies")
+		return err
+	}
+
+	return nil
+}
+
+// Print the license files found in each submodule under vendor/.
+// This is the output of -list-licenses mode.
+func listLicenses(out io.Writer, res vendetta.Result) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tLICENSE\tFILES")
+	for _, sm := range res.Submodules {
+		if sm.License == nil {
+			continue
+		}
+
+		guess, files := "unknown", strings.Join(sm.License.Files, ", ")
+		switch {
+		case len(sm.License.Files) == 0:
+			guess, files = "MISSING", "-"
+		case len(sm.License.Guess) > 0:
+			guess = strings.Join(sm.License.Guess, ", ")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", sm.Package, guess, files)
+	}
+
+	return w.Flush()
+}
@@ -1,900 +1,361 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
-	"go/build"
-	"io"
-	"io/ioutil"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
-)
-
-// TODO:
-//
-// check the directory is a git repo, and error if not
-//
-// option to run in any directory of git repo.  Needs to figure out
-// path from repo root.
-//
-// verbose option to print git commands being run
-//
-// popen should include command in errors
-//
-// Deal with git being fussy when a submodule is removed then re-added
-//
-// warn when it looks like a package ought to be present at the
-// particular path, but it's not.  E.g. when resolve an import of
-// github.com/foo/bar/baz, we find that only github.com/foo exists.
-//
-// check that declared package names match dirs
-//
-// Support relative (aka local) imports
-//
-// Warn on diamond problem
-
-type config struct {
-	rootDir     string
-	projectName string
-	update      bool
-	prune       bool
-}
-
-func main() {
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [ <project directory> ]\n",
-			os.Args[0])
-		flag.PrintDefaults()
-	}
-
-	var cf config
-
-	flag.StringVar(&cf.projectName, "n", "",
-		"base package name for the project, e.g. github.com/user/proj")
-	flag.BoolVar(&cf.update, "u", false,
-		"update dependency submodules from their remote repos")
-	flag.BoolVar(&cf.prune, "p", false,
-		"prune unused dependency submodules")
-
-	flag.Parse()
-
-	switch {
-	case flag.NArg() == 1:
-		cf.rootDir = flag.Arg(0)
-	case flag.NArg() > 1:
-		flag.Usage()
-		os.Exit(2)
-	}
-
-	if err := run(&cf); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
-	}
-}
-
-type vendetta struct {
-	*config
-	goPath
-	goPaths     map[string]*goPath
-	dirPackages map[string]*build.Package
-	submodules  []submodule
-}
-
-// A goPath says where to search for packages (analogous to
-// GOPATH). Different directories have different gopaths because there
-// can be vendor directories anywhere, not just at the top level.
-// These gopaths are produced by getGoPath and memoized in the goPaths
-// map.
-type goPath struct {
-	dir  string
-	next *goPath
-
-	// prefixes is nil for goPaths corresponding to vendor
-	// directories.  But there is also a goPath corresponding to
-	// the top-level project directory.  When searching for a
-	// package in that top-level directory, we need to remove any
-	// prefix of the package name corresponding to the root name
-	// of the project (e.g. github.com/user/proj).  prefixes is
-	// the set of such prefixes.
-	prefixes map[string]struct{}
-}
-
-type submodule struct {
-	dir  string
-	used bool
-}
-
-func run(cf *config) error {
-	v := vendetta{
-		config:      cf,
-		goPaths:     make(map[string]*goPath),
-		dirPackages: make(map[string]*build.Package),
-	}
-
-	v.goPaths[""] = &goPath{dir: "vendor", next: &v.goPath}
-	v.prefixes = make(map[string]struct{})
-
-	rootPkgs, err := v.scanRootProject()
-	if err != nil {
-		return err
-	}
 
-	if cf.projectName != "" {
-		v.prefixes[cf.projectName] = struct{}{}
-	} else {
-		if err := v.inferProjectNameFromGoPath(); err != nil {
-			return err
-		}
-
-		if err := v.inferProjectNameFromGit(); err != nil {
-			return err
-		}
-
-		v.inferProjectNameFromImportComments(rootPkgs)
-
-		if !mainOnly(rootPkgs) && len(v.prefixes) == 0 {
-			return fmt.Errorf("Unable to infer project name; specify it explicitly with the '-n' option.")
-		}
-	}
-
-	if err := v.checkSubmodules(); err != nil {
-		return err
-	}
+	"github.com/dpw/vendetta/vendetta"
+)
 
-	if err := v.populateSubmodules(); err != nil {
-		return err
-	}
+// A stringList is a flag.Value for options that take a list of
+// values, which can be comma-separated or given by repeating the
+// option.
+type stringList []string
 
-	if err := v.resolveRootProjectDeps(rootPkgs); err != nil {
-		return err
-	}
-
-	return v.pruneSubmodules()
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
 }
 
-// Attempt to infer the project name from GOPATH, by seeing if the
-// project dir resides under any element of the GOPATH.
-func (v *vendetta) inferProjectNameFromGoPath() error {
-	gp := os.Getenv("GOPATH")
-	if gp == "" {
-		return nil
-	}
-
-	gpparts := filepath.SplitList(gp)
-	gpfis := make([]os.FileInfo, len(gpparts))
-	for i, p := range gpparts {
-		var err error
-		gpfis[i], err = os.Stat(filepath.Join(p, "src"))
-		if err != nil {
-			if os.IsNotExist(err) {
-				continue
-			}
-
-			return err
+func (l *stringList) Set(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
 		}
 	}
 
-	// Get the absolute path to the project dir
-	dir := v.rootDir
-	if dir == "" {
-		dir = "."
-	}
-
-	dir, err := filepath.Abs(dir)
-	if err != nil {
-		return err
-	}
-
-	// walk from the project dir upwards towards the filesystem root
-	var proj, projsep string
-	for {
-		var subdir string
-		dir, subdir = filepath.Split(dir)
-
-		proj = subdir + projsep + proj
-		projsep = "/"
-
-		fi, err := os.Stat(dir)
-		if err != nil {
-			return err
-		}
-
-		for i, gpfi := range gpfis {
-			if gpfi != nil && os.SameFile(fi, gpfi) {
-				v.inferredProjectName(proj, "GOPATH element",
-					gpparts[i])
-				return nil
-			}
-		}
-
-		if dir != "" && dir[len(dir)-1] == os.PathSeparator {
-			dir = dir[:len(dir)-1]
-		}
-
-		if dir == "" {
-			return nil
-		}
-	}
-}
-
-var remoteUrlRE = regexp.MustCompile(`^(?:https://github\.com/|git@github\.com:)(.*\.?)$`)
-
-func (v *vendetta) inferProjectNameFromGit() error {
-	remotes, err := v.popen("git", "remote", "-v")
-	if err != nil {
-		return err
-	}
-
-	defer remotes.close()
-
-	for remotes.Scan() {
-		fields := splitWS(remotes.Text())
-		if len(fields) < 2 {
-			return fmt.Errorf("could not parse 'git remote' output")
-		}
-
-		m := remoteUrlRE.FindStringSubmatch(fields[1])
-		if m != nil {
-			name := m[1]
-			if strings.HasSuffix(name, ".git") {
-				name = name[:len(name)-4]
-			}
-
-			v.inferredProjectName("github.com/"+name,
-				"git remote", fields[0])
-		}
-	}
-
-	if err := remotes.close(); err != nil {
-		return err
-	}
-
 	return nil
 }
 
-func (v *vendetta) inferProjectNameFromImportComments(rootPkgs []rootPackage) {
-	for _, pkg := range rootPkgs {
-		ic := pkg.ImportComment
-		if ic == "" {
-			continue
-		}
-
-		// For an import comment to suggest a project name, it
-		// should have the path of the package within the
-		// project as a suffix.
-		if pkg.dir != "" {
-			suffix := pathToPackage(pkg.dir)
-			if len(ic) <= len(suffix) ||
-				ic[len(ic)-len(suffix):] != suffix &&
-					ic[len(ic)-len(suffix)-1] != '/' {
-				continue
-			}
-
-			ic = ic[:len(ic)-len(suffix)-1]
-		}
+// A packageList is a flag.Value for an option naming a file (or "-"
+// for stdin) that lists import paths, as read by
+// vendetta.ReadPackageList.  The list is never nil once set, even if
+// the file is empty.
+type packageList []string
 
-		v.inferredProjectName(ic, "import comment in",
-			v.realDir(pkg.dir))
-	}
+func (l *packageList) String() string {
+	return strings.Join(*l, ",")
 }
 
-func (v *vendetta) inferredProjectName(proj string, source ...interface{}) {
-	if _, found := v.prefixes[proj]; !found {
-		fmt.Println(append([]interface{}{
-			"Inferred root package name", proj, "from",
-		}, source...)...)
-		v.prefixes[proj] = struct{}{}
-	}
-}
-
-// Check for submodules that seem to be missing in the working tree.
-func (v *vendetta) checkSubmodules() error {
-	var err2 error
-	if err := v.querySubmodules(func(path string) bool {
-		err2 = v.checkSubmodule(path)
-		return err2 == nil
-	}, "--recursive"); err != nil {
-		return err
-	}
-
-	return err2
-}
-
-func (v *vendetta) checkSubmodule(dir string) error {
-	foundSomething := false
-	if err := readDir(v.realDir(dir), func(fi os.FileInfo) bool {
-		foundSomething = true
-		return false
-	}); err != nil && !os.IsNotExist(err) {
-		return err
-	}
-
-	if !foundSomething {
-		return fmt.Errorf("The submodule '%s' doesn't seem to the present in the working tree.  Maybe you forgot to update with 'git submodule update --init --recursive'?", dir)
-	}
-
-	return nil
-}
-
-func (v *vendetta) querySubmodules(f func(string) bool, args ...string) error {
-	status, err := v.popen("git",
-		append([]string{"submodule", "status"}, args...)...)
+func (l *packageList) Set(path string) error {
+	pkgs, err := vendetta.ReadPackageList(path)
 	if err != nil {
 		return err
 	}
 
-	defer status.close()
-
-	for status.Scan() {
-		fields := splitWS(strings.TrimSpace(status.Text()))
-		if len(fields) < 2 {
-			return fmt.Errorf("could not parse 'git submodule status' output")
-		}
-
-		path := fields[1]
-
-		if !f(path) {
-			return nil
-		}
-	}
-
-	return status.close()
-}
-
-func (v *vendetta) populateSubmodules() error {
-	var submodules []string
-	if err := v.querySubmodules(func(path string) bool {
-		submodules = append(submodules, path)
-		return true
-	}); err != nil {
-		return err
-	}
-
-	sort.Strings(submodules)
-
-	v.submodules = make([]submodule, 0, len(submodules))
-	for _, p := range submodules {
-		v.submodules = append(v.submodules, submodule{dir: p})
-	}
-
-	return nil
-}
-
-func (v *vendetta) pathInSubmodule(path string) *submodule {
-	i := sort.Search(len(v.submodules), func(i int) bool {
-		return v.submodules[i].dir >= path
-	})
-	if i < len(v.submodules) && v.submodules[i].dir == path {
-		return &v.submodules[i]
-	}
-	if i > 0 && isSubpath(path, v.submodules[i-1].dir) {
-		return &v.submodules[i-1]
-	}
+	*l = pkgs
 	return nil
 }
 
-func (v *vendetta) addSubmodule(dir string) {
-	i := sort.Search(len(v.submodules), func(i int) bool {
-		return v.submodules[i].dir >= dir
-	})
+// A stringMap is a flag.Value for options that take key=value pairs,
+// given by repeating the option.
+type stringMap map[string]string
 
-	submodules := make([]submodule, len(v.submodules)+1)
-	copy(submodules, v.submodules[:i])
-	submodules[i] = submodule{dir: dir, used: true}
-	copy(submodules[i+1:], v.submodules[i:])
-	v.submodules = submodules
-}
-
-func isSubpath(path, dir string) bool {
-	return path == dir ||
-		(strings.HasPrefix(path, dir) && path[len(dir)] == os.PathSeparator)
-}
-
-func (v *vendetta) updateSubmodule(sm *submodule) error {
-	fmt.Fprintf(os.Stderr, "Updating submodule %s from remote\n", sm.dir)
-	if err := v.git("submodule", "update", "--remote", "--recursive", sm.dir); err != nil {
-		return err
+func (m *stringMap) String() string {
+	var pairs []string
+	for k, v := range *m {
+		pairs = append(pairs, k+"="+v)
 	}
 
-	// If we don't put the updated submodule into the index, a
-	// subsequent "git submodule update" will revert it, which can
-	// lead to surprises.
-	return v.git("add", sm.dir)
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
 }
 
-func (v *vendetta) pruneSubmodules() error {
-	for _, sm := range v.submodules {
-		if sm.used || !isSubpath(sm.dir, "vendor") {
-			continue
-		}
-
-		if v.prune {
-			fmt.Fprintf(os.Stderr, "Removing unused submodule %s\n",
-				sm.dir)
-			if err := v.git("rm", "-f", sm.dir); err != nil {
-				return err
-			}
-
-			if err := v.removeEmptyDirsAbove(sm.dir); err != nil {
-				return err
-			}
-		} else {
-			fmt.Fprintf(os.Stderr, "Unused submodule %s (use -p option to prune)\n", sm.dir)
-		}
+func (m *stringMap) Set(s string) error {
+	eq := strings.Index(s, "=")
+	if eq <= 0 {
+		return fmt.Errorf("expected key=value, not '%s'", s)
 	}
 
-	return nil
-}
-
-func (v *vendetta) removeEmptyDirsAbove(dir string) error {
-	for {
-		dir = parentDir(dir)
-		if dir == "" {
-			return nil
-		}
-
-		empty := true
-		if err := readDir(v.realDir(dir), func(_ os.FileInfo) bool {
-			empty = false
-			return false
-		}); err != nil {
-			return err
-		}
-
-		if !empty {
-			return nil
-		}
-
-		if err := os.Remove(v.realDir(dir)); err != nil {
-			return err
-		}
-	}
-}
-
-// Get the directory name from a path.  path.Dir doesn't
-// do what we want in the case where there is no path
-// separator:
-func parentDir(path string) string {
-	slash := strings.LastIndexByte(path, os.PathSeparator)
-	dir := ""
-	if slash >= 0 {
-		dir = path[:slash]
+	if *m == nil {
+		*m = make(stringMap)
 	}
-	return dir
-}
-
-var wsRE = regexp.MustCompile(`[ \t]+`)
 
-func splitWS(s string) []string {
-	return wsRE.Split(s, -1)
-}
-
-func (v *vendetta) gitSubmoduleAdd(url, dir string) error {
-	fmt.Fprintf(os.Stderr, "Adding %s at %s\n", url, dir)
-	err := v.git("submodule", "add", url, dir)
-	if err != nil {
-		return err
-	}
-
-	v.addSubmodule(dir)
+	(*m)[s[:eq]] = s[eq+1:]
 	return nil
 }
 
-func (v *vendetta) git(args ...string) error {
-	return v.system("git", args...)
-}
-
-func (v *vendetta) system(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	cmd.Dir = v.rootDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Start()
-	if err == nil {
-		err = cmd.Wait()
-		if err == nil {
-			return nil
-		}
-	}
-
-	return fmt.Errorf("Command failed: %s %s (%s)",
-		name, strings.Join(args, " "), err)
-}
-
-type popenLines struct {
-	cmd    *exec.Cmd
-	stdout io.ReadCloser
-	*bufio.Scanner
-}
-
-func (v *vendetta) popen(name string, args ...string) (popenLines, error) {
-	cmd := exec.Command(name, args...)
-	cmd.Dir = v.rootDir
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return popenLines{}, err
-	}
-
-	cmd.Stderr = os.Stderr
-	p := popenLines{cmd: cmd, stdout: stdout}
-
-	if err := cmd.Start(); err != nil {
-		return popenLines{}, err
-	}
-
-	p.Scanner = bufio.NewScanner(stdout)
-	return p, nil
-}
-
-func (p popenLines) close() error {
-	res := p.Scanner.Err()
-	setRes := func(err error) {
-		if res == nil {
-			res = err
-		}
-	}
-
-	if p.stdout != nil {
-		_, err := io.Copy(ioutil.Discard, p.stdout)
-		p.stdout = nil
-		if err != nil {
-			setRes(err)
-			p.cmd.Process.Kill()
-		}
-	}
-
-	if p.cmd != nil {
-		setRes(p.cmd.Wait())
-		p.cmd = nil
-	}
-
-	return res
-}
-
-func (v *vendetta) realDir(dir string) string {
-	res := filepath.Join(v.rootDir, dir)
-	if res == "" {
-		res = "."
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [ <project directory> [ <extra root>[=<name>] ... ] ]\n",
+			os.Args[0])
+		fmt.Fprintf(os.Stderr, "If the project directory is omitted, $VENDETTA_ROOT or the current directory is used.\n")
+		fmt.Fprintf(os.Stderr, "The dependencies of any extra roots are vendored into the project too.\n")
+		flag.PrintDefaults()
 	}
 
-	return res
-}
+	var opts vendetta.Options
+	var color string
+	var stats bool
+	var jsonReport bool
+	var reportFile string
+	var skipDirs stringList
 
-type rootPackage struct {
-	dir string
-	*build.Package
-}
+	flag.StringVar(&opts.ProjectName, "n", "",
+		"base package name for the project, e.g. github.com/user/proj")
+	flag.BoolVar(&opts.Update, "u", false,
+		"update dependency submodules from their remote repos")
+	flag.BoolVar(&opts.Prune, "p", false,
+		"prune unused dependency submodules")
+	flag.BoolVar(&opts.NoTests, "no-tests", false,
+		"don't resolve the test imports of packages in the project")
+	flag.BoolVar(&opts.ModulesTxt, "modules-txt", false,
+		"write vendor/modules.txt for building in module mode")
+	flag.StringVar(&opts.GOOS, "goos", "",
+		"target operating system to resolve imports for (default $GOOS)")
+	flag.StringVar(&opts.GOARCH, "goarch", "",
+		"target architecture to resolve imports for (default $GOARCH)")
+	flag.Var((*stringList)(&opts.AllowHosts), "allow-hosts",
+		"only add submodules from these hosts (comma-separated)")
+	flag.StringVar(&color, "color", colorAuto,
+		"whether to color the summary: auto, always or never")
+	flag.BoolVar(&opts.GopkgInUpstream, "gopkg-in-upstream", false,
+		"add gopkg.in packages from their upstream repos")
+	flag.BoolVar(&opts.NestedVendor, "nested-vendor", false,
+		"let vendored dependencies use the vendor directories in their repos")
+	flag.BoolVar(&opts.List, "list", false,
+		"list dependency submodules, without changing anything")
+	flag.StringVar(&opts.SubDir, "subdir", "",
+		"only scan packages under this directory (relative to the top of the git repo)")
+	flag.BoolVar(&opts.Offline, "offline", false,
+		"fail rather than access the network")
+	flag.StringVar(&opts.Mode, "mode", vendetta.ModeSubmodule,
+		"how to add dependencies: submodule or subtree")
+	flag.BoolVar(&opts.DetectMoved, "detect-moved", false,
+		"check whether repos have moved to a different import path")
+	flag.BoolVar(&opts.NoRecurseDeps, "no-recurse-deps", false,
+		"don't resolve the imports of vendored packages")
+	flag.BoolVar(&opts.FixGitmodules, "fix-gitmodules", false,
+		"register repos under vendor/ missing from .gitmodules")
+	flag.BoolVar(&opts.UseGoList, "use-golist", false,
+		"find the project's imports with 'go list'")
+	flag.BoolVar(&opts.VerifyBuild, "verify-build", false,
+		"check that the project builds after vendoring")
+	flag.BoolVar(&stats, "stats", false,
+		"print counts and timings at the end")
+	flag.Var((*stringList)(&opts.Exclude), "exclude",
+		"don't add packages under these import paths (comma-separated)")
+	flag.Var((*stringMap)(&opts.Branches), "branch",
+		"track a branch for new submodules, as import/path=branch (repeatable)")
+	flag.StringVar(&opts.DefaultBranch, "default-branch", "",
+		"branch to track for new submodules (default the remote's default branch)")
+	flag.BoolVar(&opts.Exhaustive, "exhaustive", false,
+		"resolve the imports needed on all platforms")
+	flag.Var((*stringList)(&opts.Clean), "clean",
+		"remove and re-add the submodules providing these packages (comma-separated)")
+	flag.BoolVar(&opts.RewriteImports, "rewrite-imports", false,
+		"rewrite imports of nested vendored packages in vendored code")
+	flag.BoolVar(&opts.Hidden, "hidden", false,
+		"scan directories whose names begin with '.'")
+	flag.BoolVar(&opts.RelativePaths, "relative-paths", false,
+		"use URLs relative to the origin remote in .gitmodules where possible")
+	flag.Var((*stringList)(&opts.Tags), "tags",
+		"build tags to consider satisfied when reading packages (comma-separated)")
+	flag.BoolVar(&opts.DryRun, "dry-run", false,
+		"report what would be done, without changing anything")
+	flag.BoolVar(&opts.Tools, "tools", false,
+		"also resolve imports of files with the 'tools' or 'ignore' build tags in the project")
+	flag.Var((*stringList)(&opts.Add), "add",
+		"also add the given packages and their dependencies, even if not imported (comma-separated)")
+	flag.IntVar(&opts.CloneJobs, "clone-jobs", 4,
+		"maximum number of repos to clone at once when adding submodules")
+	flag.BoolVar(&opts.ShowStdlib, "show-stdlib", false,
+		"report imports treated as standard library packages")
+	flag.BoolVar(&opts.ShortNames, "short-names", false,
+		"name new submodules in .gitmodules after the last two elements of their import paths")
+	flag.BoolVar(&opts.Init, "init", false,
+		"check out submodules that are not initialized, and submodules within new submodules")
+	flag.Var((*packageList)(&opts.Packages), "packages",
+		"vendor the packages listed in this file ('-' for stdin), rather than scanning the project")
+	flag.BoolVar(&jsonReport, "json", false,
+		"print the result as JSON, rather than a summary")
+	flag.StringVar(&reportFile, "report-file", "",
+		"write the summary, list or JSON report to this file (overwriting it)")
+	flag.BoolVar(&opts.IncludeIgnored, "include-ignored", false,
+		"also resolve imports of files in the project excluded by build constraints")
+	flag.StringVar(&opts.OnlyHost, "only-host", "",
+		"only add submodules for repos on this host")
+	flag.BoolVar(&opts.Incremental, "incremental", false,
+		"only scan directories of the project with changes relative to -incremental-ref")
+	flag.StringVar(&opts.IncrementalRef, "incremental-ref", "HEAD",
+		"the git ref to compare against for -incremental")
+	flag.BoolVar(&opts.QuietGit, "quiet-git", false,
+		"only show the output of git commands if they fail")
+	flag.BoolVar(&opts.Strict, "strict", false,
+		"fail on directories of the project that can't be loaded, rather than warning")
+	flag.BoolVar(&opts.KeepGoing, "keep-going", false,
+		"report packages that can't be loaded and carry on without them")
+	flag.BoolVar(&opts.Trim, "trim", false,
+		"delete files in submodules that the packages used don't need (destructive)")
+	flag.StringVar(&opts.Credentials, "credentials", "",
+		"file giving tokens for HTTPS access to hosts, as lines of 'host token'")
+	flag.BoolVar(&opts.RecursiveSubmodules, "recursive-submodules", false,
+		"check out the submodules of newly added submodules")
+	flag.BoolVar(&opts.PreviewGitmodules, "preview-gitmodules", false,
+		"show how .gitmodules would change, as a diff, without changing anything")
+	flag.BoolVar(&opts.FailFast, "fail-fast", false,
+		"stop at the first error, without trying mirrors or starting more clones")
+	flag.StringVar(&opts.ReferenceCache, "reference-cache", "",
+		"directory of local clones (or the module cache) to borrow objects from when cloning")
+	flag.BoolVar(&opts.ListLicenses, "list-licenses", false,
+		"list the license files of the submodules under vendor/ rather than the summary")
+	flag.BoolVar(&opts.IgnoreExisting, "ignore-existing", false,
+		"resolve every dependency from scratch, and compare the repo URLs with .gitmodules, without changing anything")
+	flag.Var(&skipDirs, "skip-dirs",
+		"names of directories not to scan for packages (comma-separated, default testdata)")
+	flag.BoolVar(&opts.BrowseURLs, "browse-urls", false,
+		"include URLs for browsing the source of submodules in the -json output")
+	flag.BoolVar(&opts.Trace, "trace", false,
+		"log each git command, where it runs and its exit status")
+	flag.StringVar(&opts.StaleDirs, "stale-dirs", vendetta.StaleFail,
+		"what to do when a new submodule's directory already exists: fail, replace or skip")
+	flag.StringVar(&opts.Manifest, "manifest", "",
+		"compare the dependencies with the import paths listed in this file")
+	flag.BoolVar(&opts.Check, "check", false,
+		"with -manifest, fail if the dependencies differ from the manifest")
+	flag.BoolVar(&opts.VendorRepo, "vendor-repo", false,
+		"add dependency submodules to the git repo at vendor/, rather than the project's repo")
+	flag.BoolVar(&opts.AllowDotlessModules, "allow-dotless-modules", false,
+		"report imports without a dot in the first element that aren't in the standard library")
+	flag.BoolVar(&opts.GoProxy, "goproxy", false,
+		"check out the versions of new dependencies given by the module proxies in GOPROXY")
+	flag.BoolVar(&opts.DiffOnly, "diff-only", false,
+		"only list the dependency submodules that would be added or are unused, without changing anything")
+	flag.StringVar(&opts.GOPATH, "gopath", "",
+		"GOPATH to use when reading packages (default $GOPATH)")
+	flag.StringVar(&opts.GOROOT, "goroot", "",
+		"GOROOT to find standard library packages in (default $GOROOT)")
+	flag.BoolVar(&opts.Isolated, "isolated", false,
+		"read packages without using GOPATH, GOROOT, GOOS or GOARCH from the environment")
+	flag.BoolVar(&opts.CanonicalizeGitmodules, "canonicalize-gitmodules", false,
+		"rewrite .gitmodules with the submodules sorted by path")
+	flag.StringVar(&opts.AfterAdd, "after-add", "",
+		"shell command to run at the top level of the repo after adding submodules")
 
-func (v *vendetta) scanRootProject() ([]rootPackage, error) {
-	// Load each package in the root project without resolving
-	// dependencies, because we process packages in the root
-	// project slightly differently to dependency packages.
-	var pkgs []rootPackage
-	var err error
-
-	var traverseDir func(dir string, root bool)
-	traverseDir = func(dir string, root bool) {
-		var pkg *build.Package
-		pkg, err = v.loadPackage(dir, true)
-		if err != nil {
-			return
-		}
+	flag.Parse()
 
-		if pkg != nil {
-			pkgs = append(pkgs, rootPackage{dir, pkg})
+	// Giving -skip-dirs replaces the default list, so that
+	// testdata directories can be scanned with -skip-dirs=
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "skip-dirs" {
+			opts.SkipDirs = append([]string{}, skipDirs...)
 		}
+	})
 
-		err = readDir(v.realDir(dir), func(fi os.FileInfo) bool {
-			if !fi.IsDir() {
-				return true
-			}
-
-			switch fi.Name() {
-			case "vendor":
-				if root {
-					return true
-				}
-			case "testdata":
-				return true
-			}
-
-			traverseDir(filepath.Join(dir, fi.Name()), false)
-			return err == nil
-		})
-	}
-
-	traverseDir("", true)
-	if err != nil {
-		return nil, err
-	}
-
-	return pkgs, nil
-}
-
-func (v *vendetta) resolveRootProjectDeps(pkgs []rootPackage) error {
-	for _, pkg := range pkgs {
-		if err := v.resolveDependencies(pkg.dir, pkg.Imports); err != nil {
-			return err
-		}
-		if err := v.resolveDependencies(pkg.dir, pkg.TestImports); err != nil {
-			return err
-		}
-		if err := v.resolveDependencies(pkg.dir, pkg.XTestImports); err != nil {
-			return err
-		}
+	// The project directory is taken from the command line, then
+	// from VENDETTA_ROOT, and otherwise defaults to the current
+	// directory.
+	// Further directories are extra roots, whose dependencies
+	// also get vendored into the first project.
+	if flag.NArg() >= 1 {
+		opts.Root = flag.Arg(0)
+		opts.ExtraRoots = flag.Args()[1:]
+	} else {
+		opts.Root = os.Getenv("VENDETTA_ROOT")
 	}
 
-	return nil
-}
-
-func mainOnly(pkgs []rootPackage) bool {
-	for _, pkg := range pkgs {
-		if pkg.Name != "main" {
-			return false
-		}
+	switch color {
+	case colorAuto, colorAlways, colorNever:
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid value '%s' for -color (should be auto, always or never)\n", color)
+		os.Exit(2)
 	}
 
-	return true
-}
-
-func (v *vendetta) scanPackage(dir string) (*build.Package, error) {
-	if pkg := v.dirPackages[dir]; pkg != nil {
-		return pkg, nil
+	// A JSON report on stdout has to be all that goes there, so
+	// the warnings and messages that Run prints go to stderr.
+	if jsonReport && reportFile == "" {
+		opts.Stdout = os.Stderr
 	}
 
-	pkg, err := v.loadPackage(dir, false)
+	res, err := vendetta.Run(opts)
 	if err != nil {
-		return nil, err
-	}
-
-	if err = v.resolveDependencies(dir, pkg.Imports); err != nil {
-		return nil, err
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(err))
 	}
 
-	return pkg, nil
-}
-
-func (v *vendetta) loadPackage(dir string, noGoOk bool) (*build.Package, error) {
-	pkg, err := build.Default.ImportDir(v.realDir(dir), build.ImportComment)
-	if err != nil {
-		if _, ok := err.(*build.NoGoError); ok && noGoOk {
-			return nil, nil
+	// The report goes to the -report-file if given, otherwise
+	// the summary goes to stderr, and the list or JSON to stdout.
+	out, summaryOut := os.Stdout, os.Stderr
+	if reportFile != "" {
+		if out, err = os.Create(reportFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitFailure)
 		}
 
-		return nil, fmt.Errorf("gathering imports in %s: %s",
-			v.realDir(dir), err)
-	}
-
-	v.dirPackages[dir] = pkg
-	return pkg, nil
-}
-
-func (v *vendetta) resolveDependencies(dir string, deps []string) error {
-	for _, dep := range deps {
-		if err := v.resolveDependency(dir, dep); err != nil {
-			return err
-		}
+		summaryOut = out
 	}
 
-	return nil
-}
-
-func (v *vendetta) resolveDependency(dir string, pkg string) error {
-	found, pkgdir, err := v.searchGoPath(dir, pkg)
 	switch {
-	case err != nil:
-		return err
-	case found:
-		// Does the package fall within an existing submodule
-		// under vendor/ ?
-		if sm := v.pathInSubmodule(pkgdir); sm != nil && !sm.used {
-			sm.used = true
-			if v.update {
-				if err := v.updateSubmodule(sm); err != nil {
-					return err
-				}
-			}
-		}
-
+	case jsonReport:
+		err = writeJSONReport(out, res)
+	case opts.ListLicenses:
+		err = listLicenses(out, res)
+	case opts.DiffOnly:
+		err = listChanges(out, res)
+	case opts.List:
+		err = listSubmodules(out, res)
 	default:
-		pkgdir, err = v.obtainPackage(pkg)
-		if err != nil || pkgdir == "" {
-			return err
-		}
+		printSummary(summaryOut, res, opts.Prune,
+			useColor(color, summaryOut))
 	}
 
-	pi, err := v.scanPackage(pkgdir)
-	if err != nil {
-		return err
-	}
-
-	if pi.ImportComment != "" && pkg != pi.ImportComment {
-		fmt.Printf("Warning: Package with import comment %s referred to as %s (from directory %s)\n",
-			pi.ImportComment, pkg, v.realDir(dir))
-	}
-
-	return nil
-}
-
-func (v *vendetta) obtainPackage(pkg string) (string, error) {
-	bits := strings.Split(pkg, "/")
-
-	// Exclude golang standard packages
-	if !strings.Contains(bits[0], ".") {
-		return "", nil
-	}
-
-	// Figure out how to obtain the package.  Packages on
-	// github.com are treated as a special case, because that is
-	// most of them.  Otherwise, we use the queryRepoRoot code
-	// borrowed from vcs.go to figure out how to obtain the
-	// package.
-	var basePkg, url string
-	if bits[0] == "github.com" {
-		if len(bits) < 3 {
-			return "", fmt.Errorf("github.com package name %s seems to be truncated", pkg)
+	if reportFile != "" {
+		if cerr := out.Close(); err == nil {
+			err = cerr
 		}
-
-		basePkg = strings.Join(bits[:3], "/")
-		url = "https://" + basePkg
-	} else if bits[0] == "bitbucket.org" {
-		return "", fmt.Errorf("Package %s is on bitbucket.org; giving up as it might be an hg repo", pkg)
-	} else if rr, err := queryRepoRoot(pkg, secure); err == nil {
-		if rr.vcs != "git" {
-			return "", fmt.Errorf("Package %s does not live in a git repo", pkg)
-		}
-
-		basePkg = rr.root
-		url = rr.repo
-	} else if strings.HasSuffix(err.Error(), "no go-import meta tags") && len(bits) >= 3 {
-		// When no go-import meta tag is found, guess the base
-		// package and repo URL, so that e.g. package names on
-		// gitlab work.  The test above is gross, but it
-		// avoids changes to the borrowed reporoot code.
-		basePkg = strings.Join(bits[:3], "/")
-		url = fmt.Sprintf("https://%s.git", basePkg)
-		fmt.Printf("Warning: no go-import meta tags found for package '%s'. Guessing git repo URL '%s'\n", pkg, url)
-	} else {
-		return "", err
 	}
 
-	projDir := filepath.Join("vendor", packageToPath(basePkg))
-	if err := v.gitSubmoduleAdd(url, projDir); err != nil {
-		return "", err
+	if stats {
+		printStats(os.Stderr, res.Stats)
 	}
 
-	return filepath.Join("vendor", packageToPath(pkg)), nil
-}
-
-// Search the gopath for the given dir to find an existing package
-func (v *vendetta) searchGoPath(dir, pkg string) (bool, string, error) {
-	gp, err := v.getGoPath(dir)
 	if err != nil {
-		return false, "", err
-	}
-
-	for gp != nil {
-		found, pkgdir, err := gp.provides(pkg, v)
-		if err != nil {
-			return false, "", err
-		}
-
-		if found {
-			return found, pkgdir, nil
-		}
-
-		gp = gp.next
-	}
-
-	return false, "", nil
-}
-
-func (v *vendetta) getGoPath(dir string) (*goPath, error) {
-	gp := v.goPaths[dir]
-	if gp != nil {
-		return gp, nil
-	}
-
-	gp, err := v.getGoPath(parentDir(dir))
-	if err != nil {
-		return nil, err
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
 	}
 
-	// If there's a vendor/ dir here, we need to put it on the
-	// front of the gopath
-	vendorDir := filepath.Join(dir, "vendor")
-	fi, err := os.Stat(v.realDir(vendorDir))
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
-	} else if fi.IsDir() {
-		gp = &goPath{dir: vendorDir, next: gp}
+	// Scripts can tell from the exit status whether the vendoring
+	// was out of date.
+	code := exitOK
+	if res.Changed() {
+		code = exitChanged
 	}
 
-	v.goPaths[dir] = gp
-	return gp, nil
+	os.Exit(code)
 }
 
-func (gp *goPath) provides(pkg string, v *vendetta) (bool, string, error) {
-	matched, pkg := gp.removePrefix(pkg)
-	if !matched {
-		return false, "", nil
-	}
-
-	foundGoSrc := false
-	pkgdir := filepath.Join(gp.dir, packageToPath(pkg))
-	if err := readDir(v.realDir(pkgdir), func(fi os.FileInfo) bool {
-		// Should check for symlinks here?
-		if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), ".go") {
-			foundGoSrc = true
-			return false
-		}
-		return true
-	}); err != nil {
-		if os.IsNotExist(err) {
-			err = nil
-		}
-		return false, "", err
-	}
-
-	return foundGoSrc, pkgdir, nil
-}
+// Exit codes
+const (
+	exitOK         = 0
+	exitFailure    = 1
+	exitUsage      = 2
+	exitChanged    = 3
+	exitGit        = 4
+	exitUnresolved = 5
+)
 
-func (gp *goPath) removePrefix(pkg string) (bool, string) {
-	if gp.prefixes == nil {
-		return true, pkg
+// Work out the exit code for an error returned by Run: exitUsage for
+// bad options, exitGit when a git command failed (even while
+// resolving an import), exitUnresolved when an import could not be
+// resolved for another reason, and exitFailure for anything else.
+func exitCode(err error) int {
+	var ue *vendetta.UsageError
+	if errors.As(err, &ue) {
+		return exitUsage
 	}
 
-	for prefix := range gp.prefixes {
-		if pkg == prefix {
-			return true, ""
-		} else if isSubpath(pkg, prefix) {
-			return true, pkg[len(prefix)+1:]
-		}
+	var ge *vendetta.GitCommandError
+	if errors.As(err, &ge) {
+		return exitGit
 	}
 
-	return false, ""
-}
-
-// Convert a package name to a filesystem path
-func packageToPath(name string) string {
-	return filepath.FromSlash(name)
-}
-
-// Convert a filesystem path to a package name
-func pathToPackage(path string) string {
-	return filepath.ToSlash(path)
-}
-
-func readDir(dir string, f func(os.FileInfo) bool) error {
-	dh, err := os.Open(dir)
-	if err != nil {
-		return err
+	var ie *vendetta.UnresolvableImportError
+	if errors.As(err, &ie) {
+		return exitUnresolved
 	}
 
-	defer dh.Close()
-
-	for {
-		fis, err := dh.Readdir(100)
-		if err != nil {
-			if err == io.EOF {
-				return nil
-			}
-
-			return err
-		}
-
-		for _, fi := range fis {
-			if !f(fi) {
-				return nil
-			}
-		}
-	}
+	return exitFailure
 }
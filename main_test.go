@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dpw/vendetta/vendetta"
+)
+
+// When VENDETTA_TEST_MAIN is set, the test binary runs as the vendetta
+// command, so that tests can check what it writes to stdout.
+func TestMain(m *testing.M) {
+	if os.Getenv("VENDETTA_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// Run vendetta with the given arguments, returning its stdout,
+// stderr and exit status.
+func runVendetta(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "VENDETTA_TEST_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		t.Fatal(err)
+	}
+
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+// Make a git repo holding the given files, as a project for vendetta
+// to run on.
+func makeProject(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	proj := t.TempDir()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(proj, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir = proj
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+
+	return proj
+}
+
+// With -json, stdout holds only the JSON report, and the messages
+// printed along the way go to stderr.
+func TestJSONReport(t *testing.T) {
+	proj := makeProject(t, map[string]string{
+		"go.mod":  "module example.com/proj\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	})
+
+	stdout, stderr, code := runVendetta(t, "-json", proj)
+	if code != exitOK {
+		t.Fatalf("exit status %d\n%s", code, stderr)
+	}
+
+	var report map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("stdout is not JSON: %v\n%s", err, stdout)
+	}
+
+	if !strings.Contains(stderr, "Inferred root package name example.com/proj") {
+		t.Errorf("no inferred package name on stderr:\n%s", stderr)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	gitErr := &vendetta.GitCommandError{Args: []string{"clone"},
+		Err: errors.New("exit status 128")}
+	for _, c := range []struct {
+		err  error
+		want int
+	}{
+		{errors.New("failed"), exitFailure},
+		{&vendetta.UsageError{}, exitUsage},
+		{gitErr, exitGit},
+		{&vendetta.UnresolvableImportError{Path: "example.com/x",
+			Err: gitErr}, exitGit},
+		{&vendetta.UnresolvableImportError{Path: "example.com/x",
+			Err: errors.New("not found")}, exitUnresolved},
+		{fmt.Errorf("wrapped: %w", &vendetta.UnresolvableImportError{
+			Path: "example.com/x", Err: errors.New("not found")}),
+			exitUnresolved},
+	} {
+		if got := exitCode(c.err); got != c.want {
+			t.Errorf("exitCode(%v) = %d, want %d", c.err, got, c.want)
+		}
+	}
+}
+
+// An import that can't be resolved gets its own exit status.
+func TestExitUnresolved(t *testing.T) {
+	proj := makeProject(t, map[string]string{
+		"go.mod":  "module example.com/proj\n",
+		"main.go": "package main\n\nimport _ \"example.com/missing\"\n\nfunc main() {}\n",
+	})
+
+	_, stderr, code := runVendetta(t, "-offline", proj)
+	if code != exitUnresolved {
+		t.Errorf("exit status %d, want %d\n%s", code, exitUnresolved,
+			stderr)
+	}
+}
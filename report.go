@@ -0,0 +1,16 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/dpw/vendetta/vendetta"
+)
+
+// Write the result of a run as JSON.  This is the output of -json
+// mode.
+func writeJSONReport(w io.Writer, res vendetta.Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dpw/vendetta/vendetta"
+)
+
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// ANSI escape sequences
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+)
+
+// Work out whether to use color when writing to f, according to the
+// -color option and the NO_COLOR convention (see no-color.org).
+func useColor(mode string, f *os.File) bool {
+	switch mode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	return isTerminal(f)
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Print a summary of what happened to the submodules under vendor/.
+func printSummary(w io.Writer, res vendetta.Result, prune, color bool) {
+	paint := func(code string, n int) string {
+		if !color || n == 0 {
+			return fmt.Sprint(n)
+		}
+
+		return fmt.Sprint(code, n, ansiReset)
+	}
+
+	title := "Summary:"
+	if color {
+		title = ansiBold + title + ansiReset
+	}
+
+	fmt.Fprintln(w, title)
+	fmt.Fprintf(w, "  Existing submodules: %d\n", res.Existing)
+	fmt.Fprintf(w, "  Added submodules:    %s\n",
+		paint(ansiGreen, len(res.Added)))
+	if prune {
+		fmt.Fprintf(w, "  Removed submodules:  %s\n",
+			paint(ansiRed, len(res.Removed)))
+	}
+
+	direct, transitive, testOnly := 0, 0, 0
+	for _, sm := range res.Submodules {
+		if sm.Used && sm.TestOnly {
+			testOnly++
+		}
+
+		switch {
+		case sm.Direct:
+			direct++
+		case sm.Used:
+			transitive++
+		}
+	}
+
+	fmt.Fprintf(w, "  Direct deps:         %d\n", direct)
+	fmt.Fprintf(w, "  Transitive deps:     %d\n", transitive)
+	if testOnly > 0 {
+		fmt.Fprintf(w, "  Test-only deps:      %d\n", testOnly)
+	}
+}
+
+// Print the stats for a run.
+func printStats(w io.Writer, s vendetta.Stats) {
+	fmt.Fprintln(w, "Stats:")
+	fmt.Fprintf(w, "  Directories processed: %d\n", s.Dirs)
+	fmt.Fprintf(w, "  Packages resolved:     %d\n", s.Packages)
+	fmt.Fprintf(w, "  Submodules added:      %d\n", s.Added)
+	fmt.Fprintf(w, "  Total time:            %s\n", s.Time)
+	fmt.Fprintf(w, "  Time in git:           %s\n", s.GitTime)
+}
@@ -0,0 +1,592 @@
+// Package vendetta manages the dependencies in the vendor directory
+// of a Go project as git submodules.  It is what the vendetta command
+// runs, and can be used by other programs in the same way: fill in
+// the Options and call Run.
+package vendetta
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options controls a run of vendetta.
+type Options struct {
+	// Root is a directory within the git repo holding the
+	// project.  If it is empty, the current directory is used.
+	Root string
+
+	// ExtraRoots lists the directories of other projects whose
+	// dependencies should also be vendored into this project, so
+	// that they share its vendor directory.  Each can be followed
+	// by =name to give the project name; otherwise it is inferred
+	// from import comments.
+	ExtraRoots []string
+
+	// ProjectName is the base package name for the project,
+	// e.g. github.com/user/proj.  If it is empty, it is inferred.
+	ProjectName string
+
+	// Update pulls required submodules from their remote repos.
+	Update bool
+
+	// Prune removes unused submodules under vendor/.
+	Prune bool
+
+	// NoTests skips the test imports of packages in the project.
+	NoTests bool
+
+	// ModulesTxt writes vendor/modules.txt.
+	ModulesTxt bool
+
+	// GOOS and GOARCH give the target platform to resolve
+	// imports for.  If empty, the defaults from go/build apply.
+	GOOS   string
+	GOARCH string
+
+	// AllowHosts, if not empty, lists the only hosts that
+	// submodules may be added from.
+	AllowHosts []string
+
+	// GopkgInUpstream adds gopkg.in packages from their upstream
+	// repos.
+	GopkgInUpstream bool
+
+	// NestedVendor lets vendored dependencies use the vendor
+	// directories inside their own repos.
+	NestedVendor bool
+
+	// List works out the dependency submodules without changing
+	// anything.
+	List bool
+
+	// SubDir, if not empty, is the directory (relative to the top
+	// level of the git repo) under which to scan for packages.
+	// It takes precedence over the location of Root within the
+	// repo.
+	SubDir string
+
+	// Offline makes it an error to do anything that needs network
+	// access, such as adding or updating submodules.
+	Offline bool
+
+	// Mode says how dependencies are added: "submodule" (the
+	// default, if empty) or "subtree".
+	Mode string
+
+	// DetectMoved checks whether the repos of new dependencies
+	// have moved to a different import path.
+	DetectMoved bool
+
+	// NoRecurseDeps skips resolving the imports of vendored
+	// packages, so that only the direct dependencies of the
+	// project get added.
+	NoRecurseDeps bool
+
+	// FixGitmodules registers repos found under vendor/ that are
+	// missing from .gitmodules, rather than just warning about
+	// them.
+	FixGitmodules bool
+
+	// UseGoList finds the packages of the project and their
+	// dependencies by running "go list", rather than by reading
+	// the packages directly.
+	UseGoList bool
+
+	// VerifyBuild runs "go build" on the project's packages at
+	// the end, to check that nothing is missing.
+	VerifyBuild bool
+
+	// Exclude lists import path prefixes of packages that should
+	// not be added.  These are combined with the prefixes listed
+	// in the .vendettaignore file at the top level of the repo.
+	Exclude []string
+
+	// Branches maps import paths to the branches that new
+	// submodules for repos under them should track.
+	// DefaultBranch is the branch to track for other new
+	// submodules; if empty, the remote's default branch is used.
+	Branches      map[string]string
+	DefaultBranch string
+
+	// Exhaustive resolves the imports (and test imports) needed
+	// for any combination of GOOS and GOARCH, rather than just
+	// for the target platform.
+	Exhaustive bool
+
+	// Clean lists packages whose submodules should be removed
+	// and added again, to recover from a submodule in a bad
+	// state.
+	Clean []string
+
+	// RewriteImports rewrites imports in vendored packages that
+	// refer to packages in nested vendor directories, so that
+	// they refer to the top-level vendored copies instead.
+	RewriteImports bool
+
+	// Hidden scans directories in the project whose names begin
+	// with '.', which are skipped by default.
+	Hidden bool
+
+	// RelativePaths records the URLs of new submodules in
+	// .gitmodules relative to the URL of the project's origin
+	// remote, when they are on the same host.
+	RelativePaths bool
+
+	// Tags lists extra build tags to consider satisfied when
+	// reading packages.  If it is empty, the tags are taken from
+	// any -tags flag in GOFLAGS.
+	Tags []string
+
+	// Tools resolves the imports of files in the project that are
+	// only built with the "tools" or "ignore" build tags, as used
+	// to track tool dependencies.
+	Tools bool
+
+	// DryRun reports what would be done, without changing
+	// anything.  With Update, it reports how far each submodule
+	// is behind its remote branch.
+	DryRun bool
+
+	// Add lists packages to vendor, along with their
+	// dependencies, as if the project imported them.
+	Add []string
+
+	// CloneJobs is the maximum number of repos to clone at once
+	// when adding submodules, and of requests to make at once for
+	// BrowseURLs.  Values less than 1 mean 1.
+	CloneJobs int
+
+	// ShowStdlib reports each import that is treated as a
+	// standard library package, and warns if it isn't in GOROOT.
+	ShowStdlib bool
+
+	// ShortNames names new submodules in .gitmodules after the
+	// last two elements of their import paths, rather than their
+	// paths under vendor/.
+	ShortNames bool
+
+	// Init runs 'git submodule update --init --recursive' before
+	// scanning, and on newly added submodules.
+	Init bool
+
+	// IncludeIgnored resolves the imports of all files in the
+	// project's packages that are excluded by build constraints
+	// (which covers those included by Tools).
+	IncludeIgnored bool
+
+	// OnlyHost, if not empty, is the only host from which
+	// submodules may be added.
+	OnlyHost string
+
+	// Incremental only scans the directories of the project that
+	// have changes relative to IncrementalRef (HEAD if empty), or
+	// untracked files.
+	Incremental    bool
+	IncrementalRef string
+
+	// QuietGit hides the output of the git commands run, unless
+	// they fail.
+	QuietGit bool
+
+	// Packages, if not nil, lists the packages to vendor (along
+	// with their dependencies), instead of scanning the project
+	// for imports.
+	Packages []string
+
+	// Strict makes it an error if a directory of the project
+	// holds a package that can't be loaded (e.g. due to a syntax
+	// error).  Otherwise, such directories only get a warning.
+	Strict bool
+
+	// KeepGoing reports packages that can't be loaded and carries
+	// on without them, failing at the end of the run.
+	KeepGoing bool
+
+	// Trim deletes the files in the working trees of used
+	// submodules that aren't needed by the packages used from
+	// them.
+	Trim bool
+
+	// Credentials, if not empty, is a file giving a token for
+	// each host for HTTPS access to repos, as lines of "host
+	// token" or "host user:token".  The tokens are only used when
+	// git connects, and don't get recorded in .gitmodules.
+	Credentials string
+
+	// RecursiveSubmodules checks out the submodules of newly
+	// added submodules, with 'git submodule update --init
+	// --recursive'.  Init does this too.
+	RecursiveSubmodules bool
+
+	// PreviewGitmodules works out what would be done without
+	// changing anything, like DryRun, and shows the resulting
+	// changes to .gitmodules as a diff.
+	PreviewGitmodules bool
+
+	// FailFast stops at the first error, without falling back to
+	// mirrors or starting any more clones.  This is the default
+	// behaviour apart from those, and can't be combined with
+	// KeepGoing.
+	FailFast bool
+
+	// ReferenceCache, if not empty, is a directory holding local
+	// clones of repos (or the go tool's module cache), which are
+	// used as references when cloning new submodules.
+	ReferenceCache string
+
+	// ListLicenses looks for license files at the top level of
+	// each submodule under vendor/, for Submodule.License.
+	ListLicenses bool
+
+	// IgnoreExisting resolves every dependency as if nothing was
+	// vendored, without changing anything, and reports where the
+	// resulting repo URLs differ from those in .gitmodules.
+	IgnoreExisting bool
+
+	// SkipDirs lists the names of directories that are never
+	// scanned for packages, wherever they appear.  If it is nil,
+	// testdata directories are skipped, like the go tool does.
+	SkipDirs []string
+
+	// BrowseURLs finds where the source of each submodule can be
+	// browsed on the web, for Submodule.Browse.
+	BrowseURLs bool
+
+	// Trace logs each git command to stderr, with the directory
+	// it runs in, and then its exit status.  With DryRun, the
+	// commands to add submodules that were skipped are logged
+	// too.
+	Trace bool
+
+	// StaleDirs says what to do when the directory for a new
+	// submodule already exists but isn't a submodule, e.g. after
+	// an interrupted run: "fail" (the default), "replace" to
+	// remove it and add the submodule anyway, or "skip" to leave
+	// it alone.
+	StaleDirs string
+
+	// Manifest, if not empty, names a file listing the import
+	// paths of the repos that are expected to be dependencies,
+	// one per line (or "-" for stdin), to compare with the
+	// dependencies found.  The differences are reported as
+	// warnings, and in Result.NotInManifest and
+	// Result.NotImported.
+	Manifest string
+
+	// Check makes any difference from the Manifest an error.
+	Check bool
+
+	// VendorRepo treats vendor/ as a git repo of its own (such
+	// as a submodule of the project), and adds the dependency
+	// submodules to it, rather than to the project's repo.
+	VendorRepo bool
+
+	// AllowDotlessModules makes an import whose path has no dot
+	// in the first element an error if it isn't in the standard
+	// library, rather than assuming that it is.  Such import
+	// paths are legal for modules, so this catches local modules
+	// that are missing.
+	AllowDotlessModules bool
+
+	// GoProxy asks the module proxies in GOPROXY which version of
+	// each new dependency to check out: the version required by
+	// go.mod, or else the latest.  Otherwise, new submodules
+	// track the default branch of their repos.
+	GoProxy bool
+
+	// DiffOnly works out which dependency submodules are newly
+	// needed and which are no longer used, without changing
+	// anything.
+	DiffOnly bool
+
+	// GOPATH and GOROOT, if not empty, override those of the
+	// build context used to read packages.
+	GOPATH string
+	GOROOT string
+
+	// Isolated reads packages with a build context that doesn't
+	// depend on the environment: there is no GOPATH, and GOROOT,
+	// GOOS and GOARCH are those that vendetta was built with
+	// (unless set by the other options).  This makes the results
+	// the same whatever the machine's Go setup.
+	Isolated bool
+
+	// CanonicalizeGitmodules rewrites .gitmodules at the end of
+	// the run, with the submodules sorted by path and the
+	// settings of each in a fixed order, so that the file doesn't
+	// depend on the order in which submodules were added.
+	CanonicalizeGitmodules bool
+
+	// AfterAdd, if not empty, is a shell command to run at the
+	// top level of the repo after new submodules have been added,
+	// with their directories and import paths given in the
+	// VENDETTA_ADDED and VENDETTA_ADDED_PACKAGES environment
+	// variables.  If it fails, so does the run, unless KeepGoing
+	// is set.
+	AfterAdd string
+
+	// Stdout and Stderr receive the output of the run, including
+	// that of the commands it runs: warnings and reports go to
+	// Stdout, and progress messages to Stderr.  If nil, os.Stdout
+	// and os.Stderr are used.  They need not be safe for
+	// concurrent use: vendetta serializes its writes to them.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Result describes the outcome of a run.
+type Result struct {
+	// ProjectNames holds the base package names of the project.
+	ProjectNames []string `json:"projectNames"`
+
+	// Submodules holds the dependency submodules under vendor/,
+	// sorted by directory.
+	Submodules []Submodule `json:"submodules"`
+
+	// Existing is the number of submodules under vendor/ before
+	// the run.
+	Existing int `json:"existing"`
+
+	// Added, Removed and Updated hold the directories of the
+	// submodules that were added, removed, and updated to a
+	// different commit.
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Updated []string `json:"updated"`
+
+	// NotInManifest holds the import paths of dependencies that
+	// aren't listed in Options.Manifest, and NotImported those
+	// listed that are no longer dependencies.
+	NotInManifest []string `json:"notInManifest,omitempty"`
+	NotImported   []string `json:"notImported,omitempty"`
+
+	// Stats holds counts and timings for the run.
+	Stats Stats `json:"stats"`
+}
+
+// Stats holds counts and timings for a run.
+type Stats struct {
+	// Dirs is the number of directories processed, and Packages
+	// is the number of distinct import paths resolved.
+	Dirs     int `json:"dirs"`
+	Packages int `json:"packages"`
+
+	// Added is the number of submodules added.
+	Added int `json:"added"`
+
+	// Time is the total time taken, and GitTime is the time
+	// spent running git commands.
+	Time    time.Duration `json:"time"`
+	GitTime time.Duration `json:"gitTime"`
+}
+
+// Changed says whether any submodules were added, removed or
+// updated.
+func (r Result) Changed() bool {
+	return len(r.Added) > 0 || len(r.Removed) > 0 || len(r.Updated) > 0
+}
+
+// A Submodule describes a dependency submodule.
+type Submodule struct {
+	// Package is the import path corresponding to the root of
+	// the submodule.
+	Package string `json:"package"`
+
+	// Dir is the directory of the submodule, relative to the top
+	// level of the git repo.
+	Dir string `json:"dir"`
+
+	// Used is set if packages in the submodule are imported.
+	Used bool `json:"used"`
+
+	// Pending is set if the submodule is needed but was not
+	// added, because Options.List or Options.DryRun was set.
+	Pending bool `json:"pending"`
+
+	// Direct is set if packages in the project import packages
+	// in the submodule.  Otherwise, if the submodule is used, it
+	// is only needed by other dependencies.
+	Direct bool `json:"direct"`
+
+	// TestOnly is set if the submodule is only needed by the tests
+	// of packages in the project (directly, or through other
+	// dependencies), so that Options.NoTests would leave it out.
+	TestOnly bool `json:"testOnly"`
+
+	// License describes the license files of the submodule, with
+	// Options.ListLicenses.  It is nil if the submodule isn't
+	// checked out.
+	License *License `json:"license,omitempty"`
+
+	// Browse is a URL for browsing the source of the submodule,
+	// with Options.BrowseURLs, from the go-source meta tag served
+	// for its import path or the web page of its hosting site.
+	// It is empty if no such URL could be found.
+	Browse string `json:"browse,omitempty"`
+}
+
+// ReadPackageList reads a file (or stdin, if path is "-") that lists
+// import paths, one per line, as for Options.Packages.  Blank lines
+// and lines starting with '#' are ignored.  The result is never nil,
+// even if the file is empty.
+func ReadPackageList(path string) ([]string, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
+	}
+
+	pkgs := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			pkgs = append(pkgs, line)
+		}
+	}
+
+	return pkgs, scanner.Err()
+}
+
+// Output can be written from several goroutines at once (e.g. by
+// clones running in parallel), so serialize writes to the given
+// writers, with one lock, as they may be the same writer.  Files are
+// left alone, so that git can still tell when it is writing to a
+// terminal.
+func syncWriters(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	mu := new(sync.Mutex)
+	wrap := func(w io.Writer) io.Writer {
+		if _, ok := w.(*os.File); ok {
+			return w
+		}
+
+		return lockedWriter{mu, w}
+	}
+
+	return wrap(stdout), wrap(stderr)
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (lw lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// Run vendetta on a project.
+func Run(opts Options) (Result, error) {
+	if opts.SkipDirs == nil {
+		opts.SkipDirs = []string{"testdata"}
+	}
+
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+
+	opts.Stdout, opts.Stderr = syncWriters(opts.Stdout, opts.Stderr)
+
+	v := vendetta{
+		Options:       &opts,
+		rootDir:       opts.Root,
+		goPaths:       make(map[string]*goPath),
+		dirPackages:   make(map[string]*build.Package),
+		processedDirs: make(map[string]struct{}),
+		resolvedPkgs:  make(map[string]struct{}),
+		stdlibPkgs:    make(map[string]struct{}),
+		requires:      make(map[string]string),
+		start:         time.Now(),
+	}
+
+	v.goPaths[""] = &goPath{dir: "vendor", next: &v.goPath}
+	v.prefixes = make(map[string]struct{})
+
+	if err := v.run(); err != nil {
+		return Result{}, err
+	}
+
+	if v.failures > 0 {
+		return Result{}, fmt.Errorf("Some packages could not be loaded or updated, or the -after-add command failed (see the errors above)")
+	}
+
+	return v.result(), nil
+}
+
+func (v *vendetta) result() Result {
+	res := Result{
+		Existing: v.preexisting,
+		Added:    v.added,
+		Removed:  v.removed,
+		Updated:  v.updated,
+
+		NotInManifest: v.notInManifest,
+		NotImported:   v.notImported,
+
+		Stats: Stats{
+			Dirs:     len(v.processedDirs),
+			Packages: len(v.resolvedPkgs),
+			Added:    len(v.added),
+			Time:     time.Since(v.start),
+			GitTime:  v.gitTime,
+		},
+	}
+
+	for name := range v.prefixes {
+		res.ProjectNames = append(res.ProjectNames, name)
+	}
+
+	for _, gp := range v.extraRoots {
+		for name := range gp.prefixes {
+			res.ProjectNames = append(res.ProjectNames, name)
+		}
+	}
+
+	sort.Strings(res.ProjectNames)
+
+	var browse map[string]string
+	if v.BrowseURLs {
+		browse = v.browseURLs()
+	}
+
+	for _, sm := range v.submodules {
+		if !isSubpath(sm.dir, "vendor") {
+			continue
+		}
+
+		s := Submodule{
+			Package:  pathToPackage(sm.dir[len("vendor")+1:]),
+			Dir:      sm.dir,
+			Used:     sm.used,
+			Pending:  sm.pending,
+			Direct:   sm.direct,
+			TestOnly: sm.testOnly,
+			Browse:   browse[sm.dir],
+		}
+
+		if v.ListLicenses && !sm.pending {
+			s.License = findLicense(v.realDir(sm.dir))
+		}
+
+		res.Submodules = append(res.Submodules, s)
+	}
+
+	return res
+}
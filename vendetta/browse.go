@@ -0,0 +1,75 @@
+package vendetta
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Work out where the source of each submodule under vendor/ can be
+// browsed, for Submodule.Browse with -browse-urls.  The result maps
+// submodule directories to URLs.  The go-source meta tags are fetched
+// in parallel, as many at a time as Options.CloneJobs allows, and
+// failures just mean that no URL is given.
+func (v *vendetta) browseURLs() map[string]string {
+	jobs := v.CloneJobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	res := make(map[string]string)
+	sem := make(chan struct{}, jobs)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, sm := range v.submodules {
+		if !isSubpath(sm.dir, "vendor") {
+			continue
+		}
+
+		wg.Add(1)
+		go func(sm submodule) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			u := v.browseURL(pathToPackage(sm.dir[len("vendor")+1:]),
+				sm.url)
+			if u != "" {
+				mu.Lock()
+				res[sm.dir] = u
+				mu.Unlock()
+			}
+		}(sm)
+	}
+
+	wg.Wait()
+	return res
+}
+
+// Find a URL for browsing the source of the repo for pkg, which is
+// cloned from repoURL.  The go-source meta tag served for the package
+// gives the home page, or else a template for directory URLs.
+// Failing that, the web pages of the well-known hosting sites are at
+// their https clone URLs.
+func (v *vendetta) browseURL(pkg, repoURL string) string {
+	if !v.Offline && !v.private(pkg) {
+		if src, err := fetchGoSource(pkg); err == nil {
+			switch {
+			case src.home != "" && src.home != "_":
+				return src.home
+			case src.dir != "" && src.dir != "_":
+				r := strings.NewReplacer("{/dir}", "", "{dir}", "")
+				return r.Replace(src.dir)
+			}
+		}
+	}
+
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Scheme != "https" ||
+		hostingSite(u.Host) == nil {
+		return ""
+	}
+
+	u.User = nil
+	return strings.TrimSuffix(u.String(), ".git")
+}
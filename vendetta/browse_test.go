@@ -0,0 +1,71 @@
+package vendetta
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A RoundTripper that serves go-source meta tags, and records the
+// most requests it had in flight at once.
+type countingTransport struct {
+	mu                sync.Mutex
+	inFlight, maxSeen int
+}
+
+func (ct *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ct.mu.Lock()
+	ct.inFlight++
+	if ct.inFlight > ct.maxSeen {
+		ct.maxSeen = ct.inFlight
+	}
+	ct.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	ct.mu.Lock()
+	ct.inFlight--
+	ct.mu.Unlock()
+
+	pkg := req.URL.Host + req.URL.Path
+	body := fmt.Sprintf(`<html><head><meta name="go-source" content="%s https://src.example/%s _ _"></head></html>`, pkg, pkg)
+	return &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestBrowseURLsLimited(t *testing.T) {
+	ct := &countingTransport{}
+	saved := httpClient
+	httpClient = &http.Client{Transport: ct}
+	defer func() { httpClient = saved }()
+
+	v := testVendetta(t, nil)
+	v.CloneJobs = 2
+	for i := 0; i < 8; i++ {
+		v.addSubmodule(submodule{
+			dir: filepath.Join("vendor", "example.com", fmt.Sprint("p", i)),
+		})
+	}
+
+	urls := v.browseURLs()
+	if len(urls) != 8 {
+		t.Errorf("got %d URLs: %v", len(urls), urls)
+	}
+
+	want := "https://src.example/example.com/p3"
+	if u := urls[filepath.Join("vendor", "example.com", "p3")]; u != want {
+		t.Errorf("got %q, want %q", u, want)
+	}
+
+	if ct.maxSeen > 2 {
+		t.Errorf("%d requests at once, with CloneJobs 2", ct.maxSeen)
+	}
+}
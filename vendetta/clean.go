@@ -0,0 +1,102 @@
+package vendetta
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Remove and re-add the submodules named by -clean, to recover from
+// a submodule in a bad state.  Each import path given selects the
+// submodule that provides it.
+func (v *vendetta) cleanSubmodules() error {
+	if len(v.Clean) == 0 {
+		return nil
+	}
+
+	gitmodules, err := v.readGitmodules()
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range v.Clean {
+		sm, ok := v.pathInSubmodule(filepath.Join("vendor", packageToPath(pkg)))
+		if !ok || !isSubpath(sm.dir, "vendor") {
+			return fmt.Errorf("No submodule under vendor/ provides %s, so it can't be cleaned", pkg)
+		}
+
+		if sm.subtree {
+			return fmt.Errorf("%s is a subtree, so it can't be cleaned", sm.dir)
+		}
+
+		gm := gitmodules[sm.dir]
+		if gm == nil {
+			return fmt.Errorf("submodule %s not found in .gitmodules", sm.dir)
+		}
+
+		if err := v.cleanSubmodule(gm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *vendetta) cleanSubmodule(gm *gitmodule) error {
+	fmt.Fprintf(v.Stderr, "Cleaning submodule %s\n", gm.path)
+	if err := v.depsGit("submodule", "deinit", "-q", "-f",
+		v.depsPath(gm.path)); err != nil {
+		return err
+	}
+
+	if err := v.depsGit("rm", "-q", "-f", v.depsPath(gm.path)); err != nil {
+		return err
+	}
+
+	if err := v.removeModuleGitDir(gm.name); err != nil {
+		return err
+	}
+
+	// Keep the name, in case it isn't the default (see
+	// -short-names).
+	args := []string{"submodule", "add", "--name", gm.name}
+	if gm.branch != "" {
+		args = append(args, "-b", gm.branch)
+	}
+
+	return v.depsGit(append(args, gm.url, v.depsPath(gm.path))...)
+}
+
+// Remove the repo that git keeps under .git/modules for a removed
+// submodule.  Otherwise, git would reuse it (or refuse to add the
+// submodule again).
+func (v *vendetta) removeModuleGitDir(name string) error {
+	gitDir, err := v.popen("git", v.depsArgs("rev-parse", "--git-path",
+		"modules/"+name)...)
+	if err != nil {
+		return err
+	}
+
+	defer gitDir.close()
+
+	var dir string
+	if gitDir.Scan() {
+		dir = filepath.FromSlash(gitDir.Text())
+	}
+
+	if err := gitDir.close(); err != nil {
+		return err
+	}
+
+	if dir != "" {
+		if !filepath.IsAbs(dir) {
+			dir = v.realDir(filepath.Join(v.depsRepo(), dir))
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package vendetta
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// A pendingClone is a submodule that is waiting to be cloned.
+type pendingClone struct {
+	loc repoLocation
+	dir string
+}
+
+// A deferredScan is an import whose package can't be scanned until
+// the submodule providing it has been cloned.
+type deferredScan struct {
+	dir, pkg, pkgdir string
+}
+
+// Record a submodule to be cloned by finishClones.  Cloning is the
+// slow part of adding a submodule, so rather than cloning each one as
+// it is found, we collect them during the dependency walk and clone
+// them in batches, several at a time.
+func (v *vendetta) queueClone(loc repoLocation, dir string) {
+	v.addSubmodule(submodule{dir: dir, used: true, pending: true,
+		url: loc.url, branch: loc.branch, major: loc.major})
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.clones = append(v.clones, pendingClone{loc, dir})
+}
+
+// If the package at pkgdir is in a submodule that hasn't been cloned
+// yet, defer scanning it until it has been, and return true.
+func (v *vendetta) deferScan(dir, pkg, pkgdir string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	sm := v.findSubmodule(pkgdir)
+	if sm == nil || !sm.pending {
+		return false
+	}
+
+	v.deferred = append(v.deferred, deferredScan{dir, pkg, pkgdir})
+	return true
+}
+
+// Clone the queued submodules, and scan the packages that were
+// waiting for them.  Those may in turn queue more submodules, so
+// repeat until there are none left.
+func (v *vendetta) finishClones() error {
+	for {
+		v.mu.Lock()
+		clones, deferred := v.clones, v.deferred
+		v.clones, v.deferred = nil, nil
+		v.mu.Unlock()
+
+		if len(clones) == 0 && len(deferred) == 0 {
+			return nil
+		}
+
+		if err := v.cloneRepos(clones); err != nil {
+			return err
+		}
+
+		for _, d := range deferred {
+			pi, err := v.scanPackage(d.pkgdir)
+			if err != nil {
+				return v.importedBy(err, d.pkg, d.dir)
+			}
+
+			v.checkImportComment(pi, d.pkg, d.dir)
+		}
+	}
+}
+
+// errCloneSkipped marks clones not attempted due to -fail-fast.
+var errCloneSkipped = errors.New("clone skipped after an earlier failure")
+
+// Clone repos, running up to Options.CloneJobs clones at a time, and
+// then register them as submodules.  The registration updates the
+// index, so it is done one at a time.
+func (v *vendetta) cloneRepos(clones []pendingClone) error {
+	jobs := v.CloneJobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	sem := make(chan struct{}, jobs)
+	errs := make([]error, len(clones))
+	var wg sync.WaitGroup
+	var failed int32
+	for i := range clones {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// With -fail-fast, don't start more clones
+			// once one has failed.
+			if v.FailFast && atomic.LoadInt32(&failed) != 0 {
+				errs[i] = errCloneSkipped
+				return
+			}
+
+			errs[i] = v.cloneRepo(&clones[i])
+			if errs[i] != nil && errs[i] != errStaleSkipped {
+				atomic.StoreInt32(&failed, 1)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	// Register the clones that succeeded even if others failed,
+	// so that they aren't left under vendor/ without entries in
+	// .gitmodules or the index.  Then report the first real
+	// failure, rather than a skipped clone.
+	var firstErr error
+	for i, c := range clones {
+		err := errs[i]
+		if err == nil {
+			err = v.registerClone(c)
+		}
+
+		switch {
+		case err == errStaleSkipped:
+			v.dropSubmodule(c.dir)
+		case err == errCloneSkipped:
+		case err != nil && firstErr == nil:
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// The arguments to git to clone the repo at loc into dir.
+func (v *vendetta) cloneArgs(loc repoLocation, dir string) []string {
+	args := []string{"clone", "-q"}
+	if loc.branch != "" {
+		args = append(args, "-b", loc.branch)
+	}
+
+	// Borrow objects from a cached clone, but copy them, so that
+	// the submodule doesn't depend on the cache.
+	if ref := v.findReference(loc); ref != "" {
+		args = append(args, "--reference-if-able", ref, "--dissociate")
+	}
+
+	return append(args, "--", loc.url, filepath.ToSlash(dir))
+}
+
+// Clone the repo for a submodule.  If the clone fails and the repo
+// has a mirror on GitHub, try that instead (unless -fail-fast is
+// given), and update the URL to record in .gitmodules.
+func (v *vendetta) cloneRepo(c *pendingClone) error {
+	fmt.Fprintf(v.Stderr, "Adding %s at %s\n", c.loc.url, c.dir)
+	err := v.git(v.cloneArgs(c.loc, c.dir)...)
+	if err != nil && alreadyExists(err) {
+		// Clear away whatever is in the way.  Any stale index
+		// entry gets dealt with when the clone is registered.
+		if err := v.staleDir(*c, err); err != nil {
+			return err
+		}
+
+		if err := os.RemoveAll(v.realDir(c.dir)); err != nil {
+			return err
+		}
+
+		err = v.git(v.cloneArgs(c.loc, c.dir)...)
+	}
+
+	if err != nil {
+		mirror, ok := githubMirror(c.loc.url)
+		if !ok || v.FailFast {
+			return err
+		}
+
+		fmt.Fprintf(v.Stdout, "Warning: cloning %s failed, so trying its mirror %s\n",
+			c.loc.url, mirror)
+		loc := c.loc
+		loc.url = mirror
+		if err := v.git(v.cloneArgs(loc, c.dir)...); err != nil {
+			return err
+		}
+
+		c.loc.url = mirror
+	}
+
+	dir, err := v.placeMajorVersion(c)
+	if err != nil {
+		return err
+	}
+
+	if dir != c.dir {
+		v.moveSubmodule(c.dir, dir)
+		c.dir = dir
+	}
+
+	return nil
+}
+
+// Record that a pending submodule has moved to a new directory.
+func (v *vendetta) moveSubmodule(from, to string) {
+	v.mu.Lock()
+	var moved submodule
+	for i, sm := range v.submodules {
+		if sm.dir == from {
+			moved = sm
+			v.submodules = append(v.submodules[:i],
+				v.submodules[i+1:]...)
+			break
+		}
+	}
+	v.mu.Unlock()
+
+	moved.dir = to
+	v.addSubmodule(moved)
+}
+
+// Turn a freshly cloned repo into a submodule.  'git submodule add'
+// adopts the existing repo, and 'git submodule absorbgitdirs' moves
+// its .git directory under .git/modules as if it had been cloned by
+// 'git submodule add' itself.
+func (v *vendetta) registerClone(c pendingClone) error {
+	args := []string{"submodule", "--quiet", "add"}
+	if c.loc.branch != "" {
+		args = append(args, "-b", c.loc.branch)
+	}
+
+	name, err := v.newSubmoduleName(c.dir, c.loc.root)
+	if err != nil {
+		return err
+	}
+
+	if name != filepath.ToSlash(c.dir) {
+		args = append(args, "--name", name)
+	}
+
+	args = append(args, "--", c.loc.url, v.depsPath(c.dir))
+	if err := v.depsGit(args...); err != nil {
+		if !alreadyExists(err) {
+			return err
+		}
+
+		if err := v.staleDir(c, err); err != nil {
+			return err
+		}
+
+		if err := v.unstageStaleDir(c.dir, name); err != nil {
+			return err
+		}
+
+		if err := v.depsGit(args...); err != nil {
+			return err
+		}
+	}
+
+	if err := v.depsGit("submodule", "--quiet", "absorbgitdirs", "--",
+		v.depsPath(c.dir)); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.findSubmodule(c.dir).pending = false
+	v.added = append(v.added, c.dir)
+	v.mu.Unlock()
+
+	if v.RelativePaths {
+		if err := v.makeURLRelative(name, c.loc.url); err != nil {
+			return err
+		}
+	}
+
+	if c.loc.tag != "" {
+		if err := v.git("-C", c.dir, "checkout", "-q", c.loc.tag); err != nil {
+			return err
+		}
+
+		if err := v.depsGit("add", v.depsPath(c.dir)); err != nil {
+			return err
+		}
+	}
+
+	// 'git submodule add' doesn't check out the submodules of the
+	// new submodule.  Do that before its packages get scanned.
+	if v.RecursiveSubmodules || v.Init {
+		return v.initSubmodules(c.dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package vendetta
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// When one clone in a batch fails, those that succeeded still get
+// registered as submodules, rather than being left as stray repos.
+func TestCloneFailureRegistersOthers(t *testing.T) {
+	gitTestEnv(t)
+	tmp := t.TempDir()
+	good := filepath.ToSlash(filepath.Join(tmp, "good"))
+	makeGitRepo(t, filepath.Join(tmp, "good"), map[string]string{
+		"good.go": "package good\n",
+	})
+
+	proj := filepath.Join(tmp, "proj")
+	makeGitRepo(t, proj, map[string]string{
+		"main.go": "package main\n\nimport (\n\t_ \"example.com/bad\"\n\t_ \"example.com/good\"\n)\n\nfunc main() {}\n",
+		configFile: `{"rules": [
+			{"match": "^example\\.com/good$", "url": "` + good + `", "rootSegments": 2},
+			{"match": "^example\\.com/bad$", "url": "` + good + `-missing", "rootSegments": 2}]}`,
+	})
+
+	var out bytes.Buffer
+	_, err := Run(Options{
+		Root:        proj,
+		ProjectName: "example.com/proj",
+		CloneJobs:   2,
+		Stdout:      &out,
+		Stderr:      &out,
+	})
+	if err == nil {
+		t.Fatal("expected the run to fail")
+	}
+
+	gitmodules, err := ioutil.ReadFile(filepath.Join(proj, ".gitmodules"))
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+
+	if !strings.Contains(string(gitmodules), "path = vendor/example.com/good") {
+		t.Errorf("the successful clone wasn't registered:\n%s", gitmodules)
+	}
+
+	if strings.Contains(string(gitmodules), "example.com/bad") {
+		t.Errorf("the failed clone was registered:\n%s", gitmodules)
+	}
+}
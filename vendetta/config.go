@@ -0,0 +1,215 @@
+package vendetta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The optional config file at the top level of the repo.
+const configFile = ".vendetta.json"
+
+// The contents of the config file.
+type config struct {
+	// Rules say where repos live, for import paths that
+	// hostingSites doesn't know about (or to override it).
+	Rules []struct {
+		// Match is a regexp matched against the repo root,
+		// which consists of the first RootSegments elements of
+		// the import path.  URL is the clone URL, where $1 etc.
+		// are replaced by the submatches, and ${VAR} by the
+		// value of an environment variable when git connects
+		// (the reference is kept in .gitmodules, and expanded
+		// again on later runs).
+		Match        string `json:"match"`
+		URL          string `json:"url"`
+		RootSegments int    `json:"rootSegments"`
+	} `json:"rules"`
+}
+
+// A repoRule is a compiled rule from the config file.
+type repoRule struct {
+	re           *regexp.Regexp
+	url          string
+	rootSegments int
+}
+
+// Read the config file, if there is one.  Problems with it are
+// reported straight away, rather than when a rule is first needed.
+func (v *vendetta) readConfig() error {
+	data, err := ioutil.ReadFile(v.realDir(configFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	var conf config
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return fmt.Errorf("Error in %s: %s", configFile, err)
+	}
+
+	for i, r := range conf.Rules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return fmt.Errorf("Error in %s: rule %d: bad match: %s",
+				configFile, i+1, err)
+		}
+
+		if r.URL == "" || r.RootSegments <= 0 {
+			return fmt.Errorf("Error in %s: rule %d should have a url and a positive rootSegments", configFile, i+1)
+		}
+
+		v.rules = append(v.rules, repoRule{re, r.URL, r.RootSegments})
+	}
+
+	return nil
+}
+
+// Find the first rule that applies to an import path, returning a
+// hostingSites-style function for it.
+func (v *vendetta) matchRule(bits []string) func([]string) (repoLocation, error) {
+	r, root, m, found := v.findRule(bits)
+	if !found {
+		return nil
+	}
+
+	return func([]string) (repoLocation, error) {
+		url, err := v.ruleURL(r, root, m)
+		if err != nil {
+			return repoLocation{}, err
+		}
+
+		return repoLocation{root: root, url: url}, nil
+	}
+}
+
+// Find the first rule that applies to an import path, along with the
+// repo root and the submatch indices of the rule's regexp in it.
+func (v *vendetta) findRule(bits []string) (repoRule, string, []int, bool) {
+	for _, r := range v.rules {
+		if len(bits) < r.rootSegments {
+			continue
+		}
+
+		root := strings.Join(bits[:r.rootSegments], "/")
+		if m := r.re.FindStringSubmatchIndex(root); m != nil {
+			return r, root, m, true
+		}
+	}
+
+	return repoRule{}, "", nil, false
+}
+
+// Work out the clone URL that a rule gives for a repo root.  The
+// values of environment variables are often secrets such as tokens,
+// so the URL recorded in .gitmodules (and shown in messages) keeps
+// the ${VAR} references, and git is told to use the expanded URL
+// instead when it connects, as for -credentials.
+func (v *vendetta) ruleURL(r repoRule, root string, m []int) (string, error) {
+	tmpl, err := expandEnv(r.url, r.re)
+	if err != nil {
+		return "", err
+	}
+
+	url := string(r.re.ExpandString(nil, keepEnvRefs(r.url, r.re), root, m))
+	if expanded := string(r.re.ExpandString(nil, tmpl, root, m)); expanded != url {
+		v.addGitConfig("url."+expanded+".insteadOf", url)
+	}
+
+	return url, nil
+}
+
+// The URLs of submodules added through rules keep their ${VAR}
+// references in .gitmodules, so git has to be told how to expand
+// them whenever it might connect to those repos (when updating,
+// cleaning or initializing submodules), not only when adding them.
+func (v *vendetta) expandRuleURLs() error {
+	if len(v.rules) == 0 {
+		return nil
+	}
+
+	gitmodules, err := v.readGitmodules()
+	if err != nil {
+		return err
+	}
+
+	for dir, gm := range gitmodules {
+		if !strings.Contains(gm.url, "${") || dir == "vendor" ||
+			!isSubpath(dir, "vendor") {
+			continue
+		}
+
+		bits := strings.Split(pathToPackage(dir[len("vendor")+1:]), "/")
+		r, root, m, found := v.findRule(bits)
+		if !found || string(r.re.ExpandString(nil,
+			keepEnvRefs(r.url, r.re), root, m)) != gm.url {
+			continue
+		}
+
+		if _, err := v.ruleURL(r, root, m); err != nil {
+			fmt.Fprintf(v.Stdout, "Warning: %s, so git may not be able to fetch the submodule %s\n", err, dir)
+		}
+	}
+
+	return nil
+}
+
+var envRefRE = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// Expand ${VAR} references to environment variables in a URL
+// template.  References to submatches of re (${1}, or ${name} for
+// named subexpressions) are left for regexp expansion.  A variable
+// that is not set is an error, rather than silently producing a
+// broken URL.
+func expandEnv(tmpl string, re *regexp.Regexp) (string, error) {
+	var err error
+	res := replaceEnvRefs(tmpl, re, func(name string) string {
+		val, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("The environment variable %s used in %s is not set", name, configFile)
+		}
+
+		// Escape any $ so that regexp expansion leaves
+		// the value alone.
+		return strings.Replace(val, "$", "$$", -1)
+	})
+
+	return res, err
+}
+
+// Escape the ${VAR} references to environment variables in a URL
+// template, so that they survive regexp expansion as they are.
+func keepEnvRefs(tmpl string, re *regexp.Regexp) string {
+	return replaceEnvRefs(tmpl, re, func(name string) string {
+		return "$${" + name + "}"
+	})
+}
+
+// Replace the ${VAR} references to environment variables in a URL
+// template with the results of f, leaving references to submatches
+// of re.
+func replaceEnvRefs(tmpl string, re *regexp.Regexp, f func(name string) string) string {
+	submatches := make(map[string]bool)
+	for i, name := range re.SubexpNames() {
+		submatches[strconv.Itoa(i)] = true
+		if name != "" {
+			submatches[name] = true
+		}
+	}
+
+	return envRefRE.ReplaceAllStringFunc(tmpl, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if submatches[name] {
+			return ref
+		}
+
+		return f(name)
+	})
+}
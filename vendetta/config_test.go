@@ -0,0 +1,117 @@
+package vendetta
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSecret = "s3cr3t-token"
+
+// Set up a project importing a package whose repo is given by a rule
+// with a ${VAR} reference to a secret in its URL, returning the
+// project directory and the URL of the directory holding the repo.
+func ruleEnvProject(t *testing.T) (string, string) {
+	t.Helper()
+	gitTestEnv(t)
+	t.Setenv("VENDETTA_TEST_TOKEN", testSecret)
+
+	tmp := t.TempDir()
+	// git only rewrites URLs, not plain paths, with insteadOf
+	deps := "file://" + filepath.ToSlash(filepath.Join(tmp, "deps"))
+	if !strings.HasPrefix(deps, "file:///") {
+		deps = "file:///" + deps[len("file://"):]
+	}
+
+	makeGitRepo(t, filepath.Join(tmp, "deps", testSecret), map[string]string{
+		"dep.go": "package dep\n",
+	})
+
+	proj := filepath.Join(tmp, "proj")
+	makeGitRepo(t, proj, map[string]string{
+		"main.go": "package main\n\nimport _ \"example.com/dep\"\n\nfunc main() {}\n",
+		configFile: `{"rules": [{"match": "^example\\.com/dep$", "url": "` +
+			deps + `/${VENDETTA_TEST_TOKEN}", "rootSegments": 2}]}`,
+	})
+
+	return proj, deps
+}
+
+// The values of environment variables in rule URLs are secrets, so
+// they must not end up in .gitmodules or in the output.
+func TestRuleEnvNotRecorded(t *testing.T) {
+	proj, deps := ruleEnvProject(t)
+
+	var stdout, stderr bytes.Buffer
+	res, err := Run(Options{
+		Root:        proj,
+		ProjectName: "example.com/proj",
+		Trace:       true,
+		Stdout:      &stdout,
+		Stderr:      &stderr,
+	})
+	if err != nil {
+		t.Fatalf("%v\n%s%s", err, stdout.String(), stderr.String())
+	}
+
+	if len(res.Added) != 1 {
+		t.Fatalf("expected one submodule to be added, got %v", res.Added)
+	}
+
+	if _, err := os.Stat(filepath.Join(proj, "vendor", "example.com", "dep", "dep.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	gitmodules, err := ioutil.ReadFile(filepath.Join(proj, ".gitmodules"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(gitmodules), deps+"/${VENDETTA_TEST_TOKEN}") {
+		t.Errorf(".gitmodules doesn't have the URL template:\n%s", gitmodules)
+	}
+
+	for name, s := range map[string]string{
+		".gitmodules": string(gitmodules),
+		"stdout":      stdout.String(),
+		"stderr":      stderr.String(),
+	} {
+		if strings.Contains(s, testSecret) {
+			t.Errorf("%s contains the secret:\n%s", name, s)
+		}
+	}
+}
+
+// Later runs that fetch a submodule added through a rule with a
+// ${VAR} reference in its URL expand it too.
+func TestRuleEnvLaterRuns(t *testing.T) {
+	proj, _ := ruleEnvProject(t)
+	for _, opts := range []Options{
+		{},
+		{Update: true},
+		{Clean: []string{"example.com/dep"}},
+	} {
+		var out bytes.Buffer
+		opts.Root = proj
+		opts.ProjectName = "example.com/proj"
+		opts.Stdout = &out
+		opts.Stderr = &out
+		if _, err := Run(opts); err != nil {
+			t.Fatalf("%v\n%s", err, out.String())
+		}
+
+		if strings.Contains(out.String(), testSecret) {
+			t.Errorf("the output contains the secret:\n%s", out.String())
+		}
+
+		runGit(t, proj, "add", "-A")
+		runGit(t, proj, "commit", "-q", "--allow-empty", "-m", "vendor")
+	}
+
+	if _, err := os.Stat(filepath.Join(proj, "vendor", "example.com", "dep", "dep.go")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+package vendetta
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Read the credentials file given with -credentials, which has lines
+// of the form "host token" (or "host user:token"), with blank lines
+// and # comments ignored.  Rather than putting the tokens into the
+// URLs of submodules, where they would end up in .gitmodules, we
+// give git url.<base>.insteadOf settings for each host, so that the
+// URLs are only rewritten when git connects to the remote.  The
+// settings are passed through the environment, so they don't appear
+// on command lines or in error messages.
+//
+// Without a credentials file, git's credential helper (if any)
+// supplies the credentials, which is safer.
+func (v *vendetta) readCredentials() error {
+	if v.Credentials == "" {
+		return nil
+	}
+
+	f, err := os.Open(v.Credentials)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var settings []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected a host and a token",
+				v.Credentials, line)
+		}
+
+		host, token := fields[0], fields[1]
+
+		// GitHub accepts any user name with a token, but
+		// other forges need a particular one, so it can be
+		// given along with the token.
+		user := url.UserPassword("x-access-token", token)
+		if i := strings.Index(token, ":"); i >= 0 {
+			user = url.UserPassword(token[:i], token[i+1:])
+		}
+
+		settings = append(settings,
+			"url.https://"+user.String()+"@"+host+"/.insteadOf",
+			"https://"+host+"/")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	v.addGitConfig(settings...)
+	return nil
+}
+
+// Add settings (as key, value pairs) to those given to the git
+// commands we run, unless they are already there.
+func (v *vendetta) addGitConfig(pairs ...string) {
+	v.envMu.Lock()
+	defer v.envMu.Unlock()
+
+	added := false
+	for i := 0; i < len(pairs); i += 2 {
+		if !hasGitConfig(v.gitConfig, pairs[i], pairs[i+1]) {
+			v.gitConfig = append(v.gitConfig, pairs[i], pairs[i+1])
+			added = true
+		}
+	}
+
+	if added {
+		v.gitEnv = gitConfigEnv(v.gitConfig)
+	}
+}
+
+func hasGitConfig(pairs []string, key, value string) bool {
+	for i := 0; i < len(pairs); i += 2 {
+		if pairs[i] == key && pairs[i+1] == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Make the environment variables that give git the config settings
+// in pairs (key followed by value), after any that are already set.
+func gitConfigEnv(pairs []string) []string {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	var env []string
+	for i := 0; i < len(pairs); i += 2 {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", n, pairs[i]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", n, pairs[i+1]))
+		n++
+	}
+
+	return append(os.Environ(),
+		append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", n))...)
+}
@@ -0,0 +1,161 @@
+package vendetta
+
+import (
+	"fmt"
+	"go/scanner"
+	"path/filepath"
+	"strings"
+)
+
+// A UsageError reports a problem with the options or arguments
+// given to vendetta.
+type UsageError struct {
+	msg string
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &UsageError{fmt.Sprintf(format, args...)}
+}
+
+func (e *UsageError) Error() string {
+	return e.msg
+}
+
+// A GitCommandError reports that a git command failed.  Args are
+// the arguments to git, and Stderr is what the command wrote to
+// stderr (which is also passed through to our stderr).
+type GitCommandError struct {
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (e *GitCommandError) Error() string {
+	return fmt.Sprintf("Command failed: git %s (%s)",
+		strings.Join(e.Args, " "), e.Err)
+}
+
+func (e *GitCommandError) Unwrap() error {
+	return e.Err
+}
+
+// Make the error for a failed command.  All the commands we run
+// through system and popen are git commands, but in case that
+// changes, other commands get a plain error.
+func commandFailed(args []string, stderr string, err error) error {
+	if filepath.Base(args[0]) == "git" {
+		return &GitCommandError{Args: args[1:], Stderr: stderr, Err: err}
+	}
+
+	return fmt.Errorf("Command failed: %s (%s)", strings.Join(args, " "),
+		err)
+}
+
+// An UnresolvableImportError reports an import that could not be
+// resolved, along with the chain of imports that led to it.  The
+// chain is built up as the error propagates back through the
+// dependency walk, so it costs nothing unless something goes wrong.
+type UnresolvableImportError struct {
+	Path string
+
+	// ImportedBy holds the importing directories, innermost
+	// first
+	ImportedBy []string
+	Err        error
+}
+
+func (e *UnresolvableImportError) Error() string {
+	return fmt.Sprintf("package %s (imported by %s): %s", e.Path,
+		strings.Join(e.ImportedBy, ", imported by "), e.Err)
+}
+
+func (e *UnresolvableImportError) Unwrap() error {
+	return e.Err
+}
+
+// A PackageLoadError reports that the package in Dir could not be
+// loaded, e.g. due to a syntax error in one of its files.
+type PackageLoadError struct {
+	Dir string
+	Err error
+}
+
+func (e *PackageLoadError) Error() string {
+	// Give all the syntax errors, not just the first
+	msg := e.Err.Error()
+	if el, ok := e.Err.(scanner.ErrorList); ok && len(el) > 1 {
+		var lines []string
+		for _, err := range el {
+			lines = append(lines, "\t"+err.Error())
+		}
+
+		msg = "\n" + strings.Join(lines, "\n")
+	}
+
+	return fmt.Sprintf("Unable to load the package in %s: %s", e.Dir, msg)
+}
+
+func (e *PackageLoadError) Unwrap() error {
+	return e.Err
+}
+
+// An UpdateError reports that the submodule at Dir could not be
+// updated because fetching from its remote failed.  Problem says what
+// seems to be wrong, going by git's error messages.
+type UpdateError struct {
+	Dir     string
+	Problem string
+	Err     error
+}
+
+func (e *UpdateError) Error() string {
+	return fmt.Sprintf("Unable to update the submodule %s: %s (%s)",
+		e.Dir, e.Problem, e.Err)
+}
+
+func (e *UpdateError) Unwrap() error {
+	return e.Err
+}
+
+// An UnsupportedVCSError reports that the repo for Package, found
+// from its go-import meta tag, uses a version control system other
+// than git, so it can't be added as a submodule.
+type UnsupportedVCSError struct {
+	Package string
+	VCS     string
+	Repo    string
+}
+
+// The names of the version control systems that go-import meta tags
+// can give
+var vcsNames = map[string]string{
+	"bzr":    "Bazaar",
+	"fossil": "Fossil",
+	"hg":     "Mercurial",
+	"svn":    "Subversion",
+}
+
+func (e *UnsupportedVCSError) Error() string {
+	name := vcsNames[e.VCS]
+	if name == "" {
+		name = e.VCS
+	}
+
+	return fmt.Sprintf("Package %s lives in a %s repo (%s), but only git repos can be vendored as submodules; copy it into vendor/ by hand, or use a git mirror of it with a rule in %s",
+		e.Package, name, e.Repo, configFile)
+}
+
+// A ProjectInferenceError reports that the project name for the
+// project at Dir could not be inferred, so it needs to be given
+// explicitly.
+type ProjectInferenceError struct {
+	Dir string
+
+	// Hint says how to give the project name
+	Hint string
+}
+
+func (e *ProjectInferenceError) Error() string {
+	return fmt.Sprintf("Unable to infer the project name for %s; %s",
+		e.Dir, e.Hint)
+}
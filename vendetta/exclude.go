@@ -0,0 +1,56 @@
+package vendetta
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// The file at the top level of the repo listing import path prefixes
+// to exclude, in addition to those given with -exclude.
+const ignoreFile = ".vendettaignore"
+
+// Read the import path prefixes from .vendettaignore, one per line.
+// Blank lines and lines starting with '#' are ignored.
+func (v *vendetta) readIgnoreFile() ([]string, error) {
+	f, err := os.Open(v.realDir(ignoreFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var prefixes []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		prefixes = append(prefixes, strings.TrimSuffix(line, "/"))
+	}
+
+	return prefixes, scanner.Err()
+}
+
+// Is the package excluded by -exclude or .vendettaignore?
+func (v *vendetta) excluded(pkg string) bool {
+	for _, prefix := range v.excludes {
+		if isSubpackage(pkg, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Is pkg the package prefix, or a package under it?
+func isSubpackage(pkg, prefix string) bool {
+	return pkg == prefix ||
+		(strings.HasPrefix(pkg, prefix) && pkg[len(prefix)] == '/')
+}
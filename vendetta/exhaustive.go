@@ -0,0 +1,129 @@
+package vendetta
+
+import (
+	"go/build"
+	"sort"
+)
+
+// With -exhaustive, we resolve the imports needed on every platform,
+// not just the target platform.  So we also load the package with
+// every combination of GOOS and GOARCH, with cgo both enabled and
+// disabled, and merge the imports (including test imports).  pkg and err are the result of loading
+// the package for the target platform.
+func (v *vendetta) loadExhaustive(dir string, pkg *build.Package, err error) (*build.Package, error) {
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); !ok {
+			return pkg, err
+		}
+
+		// The directory might still contain files for
+		// other platforms.
+		pkg = nil
+	}
+
+	// Other platforms can only make a difference if some files
+	// were excluded by build constraints.
+	if pkg != nil && len(pkg.IgnoredGoFiles) == 0 {
+		return pkg, nil
+	}
+
+	for goos := range knownOS {
+		for goarch := range knownArch {
+			for _, cgo := range []bool{true, false} {
+				ctx := v.buildContext
+				ctx.GOOS = goos
+				ctx.GOARCH = goarch
+				ctx.CgoEnabled = cgo
+
+				p, e := ctx.ImportDir(v.realDir(dir),
+					build.ImportComment)
+				if e != nil {
+					// Not a valid package on this
+					// platform
+					continue
+				}
+
+				if pkg == nil {
+					pkg = p
+					continue
+				}
+
+				pkg.Imports = unionStrings(pkg.Imports, p.Imports)
+				pkg.TestImports = unionStrings(pkg.TestImports,
+					p.TestImports)
+				pkg.XTestImports = unionStrings(pkg.XTestImports,
+					p.XTestImports)
+			}
+		}
+	}
+
+	if pkg == nil {
+		return nil, err
+	}
+
+	return pkg, nil
+}
+
+// Packages often import different things depending on whether cgo is
+// enabled (e.g. a pure Go fallback in files with a "!cgo"
+// constraint), and the choice is made when building rather than when
+// vendoring.  So we also load the package with cgo toggled, and merge
+// the imports.  pkg and err are the result of loading the package
+// with the usual context.  (-exhaustive covers this already, as it
+// loads the package both ways on every platform.)
+func (v *vendetta) loadToggledCgo(dir string, pkg *build.Package, err error) (*build.Package, error) {
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); !ok {
+			return pkg, err
+		}
+
+		// The directory might contain only cgo files
+		pkg = nil
+	}
+
+	// Toggling cgo only makes a difference if some files were
+	// excluded by build constraints.
+	if pkg != nil && len(pkg.IgnoredGoFiles) == 0 {
+		return pkg, nil
+	}
+
+	ctx := v.buildContext
+	ctx.CgoEnabled = !ctx.CgoEnabled
+	p, e := ctx.ImportDir(v.realDir(dir), build.ImportComment)
+	switch {
+	case e != nil:
+		// Not a valid package with cgo toggled
+		return pkg, err
+	case pkg == nil:
+		return p, nil
+	}
+
+	pkg.Imports = unionStrings(pkg.Imports, p.Imports)
+	pkg.TestImports = unionStrings(pkg.TestImports, p.TestImports)
+	pkg.XTestImports = unionStrings(pkg.XTestImports, p.XTestImports)
+	return pkg, nil
+}
+
+// Merge two sorted lists of strings, omitting duplicates.
+func unionStrings(a, b []string) []string {
+	set := make(map[string]struct{}, len(a)+len(b))
+	for _, s := range a {
+		set[s] = struct{}{}
+	}
+
+	for _, s := range b {
+		set[s] = struct{}{}
+	}
+
+	if len(set) == len(a) {
+		return a
+	}
+
+	res := make([]string, 0, len(set))
+	for s := range set {
+		res = append(res, s)
+	}
+
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,37 @@
+package vendetta
+
+import (
+	"go/build"
+	"reflect"
+	"testing"
+)
+
+// The imports of files for cgo and for !cgo are both resolved,
+// whichever way cgo is set, with or without -exhaustive.
+func TestLoadPackageCgo(t *testing.T) {
+	v := testVendetta(t, map[string]string{
+		"pkg/a.go":     "package a\n",
+		"pkg/cgo.go":   "//go:build cgo\n\npackage a\n\nimport _ \"example.com/withcgo\"\n",
+		"pkg/nocgo.go": "//go:build !cgo\n\npackage a\n\nimport _ \"example.com/nocgo\"\n",
+	})
+	want := []string{"example.com/nocgo", "example.com/withcgo"}
+
+	for _, exhaustive := range []bool{false, true} {
+		for _, cgo := range []bool{false, true} {
+			v.Exhaustive = exhaustive
+			v.buildContext = build.Default
+			v.buildContext.CgoEnabled = cgo
+			v.dirPackages = make(map[string]*build.Package)
+
+			pkg, err := v.loadPackage("pkg", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(pkg.Imports, want) {
+				t.Errorf("exhaustive %v, cgo %v: imports %v, want %v",
+					exhaustive, cgo, pkg.Imports, want)
+			}
+		}
+	}
+}
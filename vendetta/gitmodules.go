@@ -0,0 +1,445 @@
+package vendetta
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A gitmodule holds the settings for a submodule from .gitmodules.
+type gitmodule struct {
+	name   string
+	path   string
+	url    string
+	branch string
+}
+
+// Read the .gitmodules file for the dependency submodules (which is
+// the vendor repo's with -vendor-repo), returning the entries keyed
+// by path relative to the top level of the project's repo.
+func (v *vendetta) readGitmodules() (map[string]*gitmodule, error) {
+	res := make(map[string]*gitmodule)
+	file := filepath.Join(v.depsRepo(), ".gitmodules")
+	if _, err := os.Stat(v.realDir(file)); err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+
+		return nil, err
+	}
+
+	sections, err := v.readGitmodulesSections(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range sections {
+		gm := &gitmodule{name: s.name}
+		for _, kv := range s.settings {
+			switch kv[0] {
+			case "path":
+				gm.path = filepath.Join(v.depsRepo(),
+					filepath.FromSlash(kv[1]))
+			case "url":
+				gm.url = kv[1]
+			case "branch":
+				gm.branch = kv[1]
+			}
+		}
+
+		if gm.path != "" {
+			res[gm.path] = gm
+		}
+	}
+
+	return res, nil
+}
+
+func splitNUL(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// Look for repos under vendor/ that have no entry in .gitmodules.
+// This can happen when an entry gets lost in a bad merge.  git
+// won't treat them as submodules (and 'git submodule status' fails
+// if they are still in the index), so we warn about them, or
+// re-register them with -fix-gitmodules.
+func (v *vendetta) checkOrphanedSubmodules() error {
+	if _, err := os.Stat(v.realDir("vendor")); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	gitmodules, err := v.readGitmodules()
+	if err != nil {
+		return err
+	}
+
+	var orphans []string
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		if gitmodules[dir] != nil {
+			return nil
+		}
+
+		// With -vendor-repo, vendor/ is a repo, but it holds
+		// the dependency submodules.
+		isRepo := false
+		top := v.VendorRepo && dir == v.depsRepo()
+		var subdirs []string
+		if err := readDir(v.realDir(dir), func(fi os.FileInfo) bool {
+			// .git is a file rather than a directory if
+			// the repo's git directory is elsewhere (as for
+			// submodules), so don't check which it is.
+			if fi.Name() == ".git" && !top {
+				isRepo = true
+				return false
+			}
+
+			if fi.IsDir() && !strings.HasPrefix(fi.Name(), ".") {
+				subdirs = append(subdirs, fi.Name())
+			}
+
+			return true
+		}); err != nil {
+			return err
+		}
+
+		if isRepo {
+			orphans = append(orphans, dir)
+			return nil
+		}
+
+		for _, subdir := range subdirs {
+			if err := walk(filepath.Join(dir, subdir)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk("vendor"); err != nil {
+		return err
+	}
+
+	sort.Strings(orphans)
+	for _, dir := range orphans {
+		if !v.FixGitmodules || !v.mutating() {
+			fmt.Fprintf(v.Stdout, "Warning: %s is a repository without an entry in .gitmodules (use -fix-gitmodules to register it as a submodule)\n", dir)
+			continue
+		}
+
+		if err := v.registerSubmodule(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Add the .gitmodules entry for an existing repo, taking the URL
+// from its origin remote.
+func (v *vendetta) registerSubmodule(dir string) error {
+	url, err := v.remoteURL(dir, "origin")
+	if err != nil {
+		return err
+	}
+
+	if url == "" {
+		return fmt.Errorf("Unable to register %s as a submodule: it has no origin remote", dir)
+	}
+
+	fmt.Fprintf(v.Stderr, "Registering %s as a submodule\n", dir)
+	name := v.depsPath(dir)
+	if err := v.depsGit("config", "-f", ".gitmodules",
+		"submodule."+name+".path", name); err != nil {
+		return err
+	}
+
+	if err := v.depsGit("config", "-f", ".gitmodules",
+		"submodule."+name+".url", url); err != nil {
+		return err
+	}
+
+	return v.depsGit("add", ".gitmodules", name)
+}
+
+// Get the URL of a remote of the repo at dir, or "" if there is no
+// such remote.
+func (v *vendetta) remoteURL(dir, name string) (string, error) {
+	remote, err := v.popen("git", "-C", v.realDir(dir), "config",
+		"--default", "", "--get", "remote."+name+".url")
+	if err != nil {
+		return "", err
+	}
+
+	defer remote.close()
+
+	var url string
+	if remote.Scan() {
+		url = remote.Text()
+	}
+
+	return url, remote.close()
+}
+
+// With -relative-paths, change the URL recorded in .gitmodules for
+// the submodule with the given name to be relative to the URL of the
+// project's origin remote, if they are on the same host.  Then the
+// repo and its submodules can be cloned from a mirror of that host.
+func (v *vendetta) makeURLRelative(name, url string) error {
+	rel, err := v.relativeURL(url)
+	if err != nil || rel == url {
+		return err
+	}
+
+	if err := v.depsGit("config", "-f", ".gitmodules",
+		"submodule."+name+".url", rel); err != nil {
+		return err
+	}
+
+	return v.depsGit("add", ".gitmodules")
+}
+
+// Work out the URL to record for a submodule with -relative-paths.
+// git resolves it relative to the repo that the submodule belongs to.
+func (v *vendetta) relativeURL(url string) (string, error) {
+	origin, err := v.remoteURL(v.depsRepo(), "origin")
+	if err != nil || origin == "" {
+		return url, err
+	}
+
+	if rel, ok := relativeRepoURL(origin, url); ok {
+		return rel, nil
+	}
+
+	return url, nil
+}
+
+// Work out the URL of a repo relative to the URL of a parent repo.
+// git resolves relative submodule URLs by removing a path element
+// from the URL of the parent for each leading "../".
+func relativeRepoURL(parent, url string) (string, bool) {
+	parentBits := strings.Split(normalizeRepoURL(parent), "/")
+	bits := strings.Split(normalizeRepoURL(url), "/")
+	if parentBits[0] == "" || parentBits[0] != bits[0] {
+		return "", false
+	}
+
+	// Drop the host, and find the elements in common, not
+	// counting the parent repo's own name.
+	parentBits, bits = parentBits[1:], bits[1:]
+	common := 0
+	for common < len(parentBits)-1 && common < len(bits) &&
+		parentBits[common] == bits[common] {
+		common++
+	}
+
+	return strings.Repeat("../", len(parentBits)-common) +
+		strings.Join(bits[common:], "/"), true
+}
+
+// Work out the name for a new submodule at dir, whose repo root is
+// root.  git names submodules after their paths, unless told
+// otherwise.
+func (v *vendetta) newSubmoduleName(dir, root string) (string, error) {
+	if v.ShortNames {
+		name, err := v.shortSubmoduleName(root)
+		if err != nil || name != "" {
+			return name, err
+		}
+	}
+
+	return v.depsPath(dir), nil
+}
+
+// With -short-names, work out the name for a new submodule from the
+// last two elements of the import path of its repo root, rather than
+// letting git name it after its path under vendor/.  If that name is
+// already taken, return "" to use the default.
+func (v *vendetta) shortSubmoduleName(root string) (string, error) {
+	bits := strings.Split(root, "/")
+	if len(bits) > 2 {
+		bits = bits[len(bits)-2:]
+	}
+
+	name := strings.Join(bits, "/")
+	gitmodules, err := v.readGitmodules()
+	if err != nil {
+		return "", err
+	}
+
+	for _, gm := range gitmodules {
+		if gm.name == name {
+			return "", nil
+		}
+	}
+
+	return name, nil
+}
+
+// A submodule section of a .gitmodules file, with its settings in
+// the order they appear.
+type gitmodulesSection struct {
+	name     string
+	path     string
+	settings [][2]string
+}
+
+// The order of the settings in each section of a canonical
+// .gitmodules file.  Any others follow, sorted by name.
+var gitmodulesKeyOrder = map[string]int{"path": 1, "url": 2, "branch": 3}
+
+// With -canonicalize-gitmodules, rewrite the .gitmodules file for the
+// dependency submodules with the sections sorted by path, and the
+// settings in each in a fixed order, so that re-running vendetta gives
+// minimal diffs.  Sections other than those for submodules are left
+// alone.
+func (v *vendetta) canonicalizeGitmodules() error {
+	if !v.CanonicalizeGitmodules {
+		return nil
+	}
+
+	file := filepath.Join(v.depsRepo(), ".gitmodules")
+	if _, err := os.Stat(v.realDir(file)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	sections, err := v.readGitmodulesSections(file)
+	if err != nil {
+		return err
+	}
+
+	before := gitmodulesLayout(sections)
+	sort.SliceStable(sections, func(i, j int) bool {
+		if sections[i].path != sections[j].path {
+			return sections[i].path < sections[j].path
+		}
+
+		return sections[i].name < sections[j].name
+	})
+
+	for _, s := range sections {
+		settings := s.settings
+		sort.SliceStable(settings, func(i, j int) bool {
+			ki, kj := settings[i][0], settings[j][0]
+			oi, oj := gitmodulesKeyOrder[ki], gitmodulesKeyOrder[kj]
+			if oi == 0 || oj == 0 {
+				if oi != oj {
+					return oj == 0
+				}
+
+				return ki < kj
+			}
+
+			return oi < oj
+		})
+	}
+
+	if gitmodulesLayout(sections) == before {
+		return nil
+	}
+
+	fmt.Fprintf(v.Stderr, "Sorting the entries in %s\n", file)
+
+	// git config appends new sections to the end of the file, so
+	// remove them all and add them back in order.
+	for _, s := range sections {
+		if err := v.depsGit("config", "-f", ".gitmodules",
+			"--remove-section", "submodule."+s.name); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range sections {
+		for _, kv := range s.settings {
+			if err := v.depsGit("config", "-f", ".gitmodules", "--add",
+				"submodule."+s.name+"."+kv[0], kv[1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return v.depsGit("add", ".gitmodules")
+}
+
+// Read the submodule sections of a .gitmodules file, in the order
+// they appear.
+func (v *vendetta) readGitmodulesSections(file string) ([]*gitmodulesSection, error) {
+	list, err := v.popen("git", "config", "-f", filepath.ToSlash(file),
+		"-z", "--list")
+	if err != nil {
+		return nil, err
+	}
+
+	defer list.close()
+
+	// With -z, each entry is the key and value separated by a
+	// newline, terminated by a NUL.
+	list.Split(splitNUL)
+	var sections []*gitmodulesSection
+	byName := make(map[string]*gitmodulesSection)
+	for list.Scan() {
+		kv := strings.SplitN(list.Text(), "\n", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], "submodule.") {
+			continue
+		}
+
+		key := kv[0][len("submodule."):]
+		dot := strings.LastIndexByte(key, '.')
+		if dot < 0 {
+			continue
+		}
+
+		name := key[:dot]
+		s := byName[name]
+		if s == nil {
+			s = &gitmodulesSection{name: name}
+			byName[name] = s
+			sections = append(sections, s)
+		}
+
+		if key[dot+1:] == "path" {
+			s.path = kv[1]
+		}
+
+		s.settings = append(s.settings, [2]string{key[dot+1:], kv[1]})
+	}
+
+	return sections, list.close()
+}
+
+// Describe the order of the sections and settings in a .gitmodules
+// file, to tell whether it needs rewriting.
+func gitmodulesLayout(sections []*gitmodulesSection) string {
+	var b strings.Builder
+	for _, s := range sections {
+		b.WriteString(s.name)
+		for _, kv := range s.settings {
+			b.WriteString("\x00" + kv[0])
+		}
+
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
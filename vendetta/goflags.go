@@ -0,0 +1,98 @@
+package vendetta
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Get the build tags given by a -tags flag in GOFLAGS, so that the
+// packages are read with the same tags as the go tool will use.
+func goflagsTags() ([]string, error) {
+	fields, err := splitQuoted(goEnv("GOFLAGS"))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse GOFLAGS: %v", err)
+	}
+
+	// GOFLAGS holds flags separated by spaces, each of which has
+	// to give its value after '=' rather than as a separate
+	// argument.  If -tags appears more than once, the last one
+	// wins, as on the command line.
+	var tags []string
+	for _, field := range fields {
+		name := strings.TrimPrefix(strings.TrimPrefix(field, "-"), "-")
+		if !strings.HasPrefix(name, "tags=") {
+			continue
+		}
+
+		// The tags are comma-separated, but the go tool still
+		// accepts the old space-separated form.
+		value := name[len("tags="):]
+		sep := ","
+		if !strings.Contains(value, ",") {
+			sep = " "
+		}
+
+		tags = nil
+		for _, tag := range strings.Split(value, sep) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags, nil
+}
+
+// Get a go setting.  As for the go tool, the environment variable
+// takes precedence.  If it is unset, ask the go tool, which also
+// knows about settings made with 'go env -w'.
+func goEnv(name string) string {
+	if value, found := os.LookupEnv(name); found {
+		return value
+	}
+
+	out, err := exec.Command("go", "env", name).Output()
+	if err != nil {
+		return os.Getenv(name)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// Split a string into fields separated by spaces, where a field may
+// be enclosed in single or double quotes to include spaces, as the go
+// tool does for GOFLAGS.
+func splitQuoted(s string) ([]string, error) {
+	var res []string
+	for {
+		s = strings.TrimLeft(s, " \t\n\r")
+		if s == "" {
+			return res, nil
+		}
+
+		if q := s[0]; q == '\'' || q == '"' {
+			end := strings.IndexByte(s[1:], q)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %c string", q)
+			}
+
+			res = append(res, s[1:1+end])
+			s = s[2+end:]
+			if s != "" && !strings.ContainsRune(" \t\n\r", rune(s[0])) {
+				return nil, fmt.Errorf("quoted string not followed by space")
+			}
+
+			continue
+		}
+
+		end := strings.IndexAny(s, " \t\n\r")
+		if end < 0 {
+			end = len(s)
+		}
+
+		res = append(res, s[:end])
+		s = s[end:]
+	}
+}
@@ -0,0 +1,70 @@
+package vendetta
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// Put a fake go tool on PATH, whose 'go env' prints value.
+func fakeGoEnv(t *testing.T, value string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go tool is a shell script")
+	}
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go": "#!/bin/sh\necho '" + value + "'\n",
+	})
+	if err := os.Chmod(filepath.Join(dir, "go"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir)
+}
+
+// Unset an environment variable for the duration of a test.
+func unsetenv(t *testing.T, name string) {
+	t.Setenv(name, "")
+	os.Unsetenv(name)
+}
+
+func TestGoflagsTags(t *testing.T) {
+	fakeGoEnv(t, "-tags=fromgoenv")
+	for _, c := range []struct {
+		goflags string
+		want    []string
+	}{
+		{"-mod=vendor -tags=a,b", []string{"a", "b"}},
+		{"--tags=a -tags=b", []string{"b"}},
+		{"'-tags=a b'", []string{"a", "b"}},
+		{"-mod=vendor", nil},
+		// Set but empty still overrides go env
+		{"", nil},
+	} {
+		t.Setenv("GOFLAGS", c.goflags)
+		tags, err := goflagsTags()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(tags, c.want) {
+			t.Errorf("GOFLAGS=%q gave tags %v, want %v",
+				c.goflags, tags, c.want)
+		}
+	}
+
+	// When GOFLAGS is unset, the go tool is asked
+	unsetenv(t, "GOFLAGS")
+	tags, err := goflagsTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(tags, []string{"fromgoenv"}) {
+		t.Errorf("got tags %v from go env", tags)
+	}
+}
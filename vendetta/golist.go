@@ -0,0 +1,145 @@
+package vendetta
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The fields we use from the output of "go list -json".
+type goListPackage struct {
+	Dir           string
+	ImportPath    string
+	ImportComment string
+	Name          string
+	Standard      bool
+	DepOnly       bool
+	Imports       []string
+	TestImports   []string
+	XTestImports  []string
+}
+
+// Find the packages of the root project and their imports by
+// running "go list", as an alternative to scanRootProject.  This
+// gets the go tool's own view of the imports (e.g. respecting
+// go.mod).  Along with the root packages, it returns the import
+// paths of all non-standard packages they depend on, directly or
+// indirectly.
+func (v *vendetta) goListRootProject() ([]rootPackage, []string, error) {
+	cmd := v.goCommand("list", "-e", "-deps", "-json", "./...")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	root, err := filepath.EvalSymlinks(v.rootDir)
+	if err != nil {
+		root = v.rootDir
+	}
+
+	var pkgs []rootPackage
+	var deps []string
+	dec := json.NewDecoder(stdout)
+	for {
+		var p goListPackage
+		if err = dec.Decode(&p); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+
+			break
+		}
+
+		if p.Standard {
+			continue
+		}
+
+		if p.DepOnly {
+			deps = append(deps, p.ImportPath)
+			continue
+		}
+
+		var dir string
+		if dir, err = filepath.Rel(root, p.Dir); err != nil {
+			break
+		}
+
+		if dir == "." {
+			dir = ""
+		}
+
+		pkgs = append(pkgs, rootPackage{dir, &build.Package{
+			Dir:           p.Dir,
+			Name:          p.Name,
+			ImportPath:    p.ImportPath,
+			ImportComment: p.ImportComment,
+			Imports:       p.Imports,
+			TestImports:   p.TestImports,
+			XTestImports:  p.XTestImports,
+		}})
+	}
+
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, nil, fmt.Errorf("Unable to parse 'go list' output: %s", err)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, nil, fmt.Errorf("Command failed: %s (%s)",
+			strings.Join(cmd.Args, " "), err)
+	}
+
+	for _, pkg := range pkgs {
+		v.markProcessed(pkg.dir)
+	}
+
+	return pkgs, deps, nil
+}
+
+// Check that the packages of the project build, now that their
+// dependencies are vendored.
+func (v *vendetta) verifyBuild() error {
+	fmt.Fprintf(v.Stderr, "Verifying the build\n")
+	cmd := v.goCommand("build", "./...")
+	cmd.Stdout = v.Stdout
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Build failed after vendoring: %s (%s)",
+			strings.Join(cmd.Args, " "), err)
+	}
+
+	return nil
+}
+
+// Prepare to run the go tool on the packages being scanned, for the
+// target platform.
+func (v *vendetta) goCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = v.realDir(v.scanDir)
+	cmd.Stderr = v.Stderr
+	cmd.Env = append(os.Environ(),
+		"GOOS="+v.buildContext.GOOS,
+		"GOARCH="+v.buildContext.GOARCH)
+	if !v.buildContext.CgoEnabled {
+		cmd.Env = append(cmd.Env, "CGO_ENABLED=0")
+	}
+
+	if v.GOPATH != "" {
+		cmd.Env = append(cmd.Env, "GOPATH="+v.GOPATH)
+	}
+
+	if v.GOROOT != "" {
+		cmd.Env = append(cmd.Env, "GOROOT="+v.GOROOT)
+	}
+
+	return cmd
+}
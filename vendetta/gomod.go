@@ -0,0 +1,250 @@
+package vendetta
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A replacement is a replace directive from go.mod, saying that the
+// module old should be obtained from the module new.
+type replacement struct {
+	old, new string
+}
+
+// Read the module, require and replace directives from the go.mod
+// file of the project, if there is one.  The scanned directory may be
+// a subdirectory of the module, so go.mod is looked for there and
+// then in each parent directory up to the top level of the repo, as
+// the go tool would.  Replacements by other modules are
+// recorded so that obtainPackage clones from the replacement repo.
+// Replacements by local directories are treated as extra roots: they
+// are part of the build, so their dependencies get vendored, but they
+// don't get a submodule.
+func (v *vendetta) readGoMod() error {
+	var f *os.File
+	var path string
+	for dir := v.scanDir; ; dir = parentDir(dir) {
+		path = filepath.Join(v.realDir(dir), "go.mod")
+		var err error
+		if f, err = os.Open(path); err == nil {
+			v.goModDir = dir
+			break
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		if dir == "" {
+			return nil
+		}
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	block := ""
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "//"); i >= 0 {
+			text = text[:i]
+		}
+
+		// A directive can be on a line of its own, or inside a
+		// "verb ( ... )" block.
+		var verb string
+		fields := strings.Fields(text)
+		switch {
+		case block != "":
+			if len(fields) == 1 && fields[0] == ")" {
+				block = ""
+				continue
+			}
+
+			verb = block
+		case len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case len(fields) > 0:
+			verb, fields = fields[0], fields[1:]
+		default:
+			continue
+		}
+
+		switch verb {
+		case "module":
+			if len(fields) > 0 {
+				v.modulePath = strings.Trim(fields[0], `"`)
+			}
+		case "require":
+			if len(fields) < 2 {
+				return fmt.Errorf("%s:%d: malformed require directive", path, line)
+			}
+
+			v.requires[strings.Trim(fields[0], `"`)] = fields[1]
+		case "replace":
+			if err := v.addReplacement(fields); err != nil {
+				return fmt.Errorf("%s:%d: %s", path, line, err)
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Record a replace directive from go.mod.
+func (v *vendetta) addReplacement(fields []string) error {
+	// It looks like "old [version] => new [version]"
+	arrow := -1
+	for i, field := range fields {
+		if field == "=>" {
+			arrow = i
+		}
+	}
+
+	if arrow < 1 || arrow > 2 || len(fields) < arrow+2 ||
+		len(fields) > arrow+3 {
+		return fmt.Errorf("malformed replace directive")
+	}
+
+	from, to := strings.Trim(fields[0], `"`),
+		strings.Trim(fields[arrow+1], `"`)
+	if isLocalPath(to) {
+		if !filepath.IsAbs(to) {
+			to = filepath.Join(v.realDir(v.goModDir), to)
+		}
+
+		v.replaceRoots = append(v.replaceRoots, to+"="+from)
+	} else {
+		v.replaces = append(v.replaces, replacement{from, to})
+	}
+
+	return nil
+}
+
+// Is the target of a replace directive a local directory, rather
+// than a module path?  go.mod uses the same rule.
+func isLocalPath(path string) bool {
+	return strings.HasPrefix(path, "./") ||
+		strings.HasPrefix(path, "../") || filepath.IsAbs(path) ||
+		path == "." || path == ".."
+}
+
+// Find the replace directive that applies to pkg, if any.  Where
+// modules are nested, the longest match wins.
+func (v *vendetta) replacement(pkg string) (replacement, bool) {
+	var match replacement
+	found := false
+	for _, r := range v.replaces {
+		if isSubpackage(pkg, r.old) && len(r.old) > len(match.old) {
+			match, found = r, true
+		}
+	}
+
+	return match, found
+}
+
+// Warn about submodules whose checked out commit doesn't match the
+// version of the module required by go.mod.  This is only advisory:
+// vendetta tracks branches, not versions.
+func (v *vendetta) checkRequiredVersions() error {
+	for _, sm := range v.submodules {
+		if sm.pending || !isSubpath(sm.dir, "vendor") {
+			continue
+		}
+
+		// Skip subtrees, and submodules that aren't checked out
+		_, err := os.Stat(filepath.Join(v.realDir(sm.dir), ".git"))
+		if err != nil {
+			continue
+		}
+
+		pkg := pathToPackage(sm.dir[len("vendor")+1:])
+		for mod, version := range v.requires {
+			if !isSubpackage(mod, pkg) {
+				continue
+			}
+
+			// A module in a subdirectory of a repo has tags
+			// prefixed by the subdirectory, not including
+			// any major version suffix.
+			tag := strings.TrimSuffix(version, "+incompatible")
+			if mod != pkg {
+				sub := majorVersionRE.ReplaceAllString("/"+mod[len(pkg)+1:], "")
+				if sub != "" {
+					tag = sub[1:] + "/" + tag
+				}
+			}
+
+			ok, err := v.versionCheckedOut(sm.dir, tag)
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				fmt.Fprintf(v.Stdout, "Warning: go.mod requires %s %s, but the submodule %s has %s checked out\n",
+					mod, version, sm.dir, v.describeHead(sm.dir))
+			}
+		}
+	}
+
+	return nil
+}
+
+// A pseudo-version ends with a timestamp and a 12-character commit
+// hash, e.g. v0.0.0-20191109021931-daa7c04131f5.
+var pseudoVersionRE = regexp.MustCompile(`[.-]\d{14}-([0-9a-f]{12})$`)
+
+// Is the commit for a module version (a tag or a pseudo-version)
+// checked out in the submodule at dir?
+func (v *vendetta) versionCheckedOut(dir, tag string) (bool, error) {
+	head, err := v.submoduleHead(dir)
+	if err != nil {
+		return false, err
+	}
+
+	if m := pseudoVersionRE.FindStringSubmatch(tag); m != nil {
+		return strings.HasPrefix(head, m[1]), nil
+	}
+
+	tags, err := v.popen("git", "-C", dir, "tag", "--points-at", head)
+	if err != nil {
+		return false, err
+	}
+
+	defer tags.close()
+
+	found := false
+	for tags.Scan() {
+		if tags.Text() == tag {
+			found = true
+		}
+	}
+
+	return found, tags.close()
+}
+
+// Describe the commit checked out in a submodule in terms of the
+// nearest tag, for messages.
+func (v *vendetta) describeHead(dir string) string {
+	desc, err := v.popen("git", "-C", dir, "describe", "--tags",
+		"--always")
+	if err != nil {
+		return "an unknown commit"
+	}
+
+	defer desc.close()
+
+	res := "an unknown commit"
+	if desc.Scan() {
+		res = desc.Text()
+	}
+
+	if desc.close() != nil {
+		return "an unknown commit"
+	}
+
+	return res
+}
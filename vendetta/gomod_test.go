@@ -0,0 +1,63 @@
+package vendetta
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func readTestGoMod(t *testing.T, files map[string]string, scanDir string) *vendetta {
+	t.Helper()
+	v := testVendetta(t, files)
+	v.scanDir = filepath.FromSlash(scanDir)
+	v.requires = make(map[string]string)
+	if err := v.readGoMod(); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+// When scanning a subdirectory of the module, go.mod is found in a
+// parent directory, and local replacements are relative to it.
+func TestReadGoModFromParent(t *testing.T) {
+	v := readTestGoMod(t, map[string]string{
+		"go.mod":           "module example.com/proj\n\nrequire example.com/d v1.2.3\n\nreplace example.com/x => ./local\n",
+		"cmd/tool/main.go": "package main\n",
+	}, "cmd/tool")
+
+	if v.goModDir != "" || v.modulePath != "example.com/proj" {
+		t.Errorf("read module %q from %q", v.modulePath, v.goModDir)
+	}
+
+	if v.requires["example.com/d"] != "v1.2.3" {
+		t.Errorf("requires %v", v.requires)
+	}
+
+	want := filepath.Join(v.rootDir, "local") + "=example.com/x"
+	if len(v.replaceRoots) != 1 || v.replaceRoots[0] != want {
+		t.Errorf("replace roots %v, want [%s]", v.replaceRoots, want)
+	}
+}
+
+// The nearest go.mod wins.
+func TestReadGoModNearest(t *testing.T) {
+	v := readTestGoMod(t, map[string]string{
+		"go.mod":           "module example.com/proj\n",
+		"cmd/go.mod":       "module example.com/proj/cmd\n",
+		"cmd/tool/main.go": "package main\n",
+	}, "cmd/tool")
+
+	if v.goModDir != "cmd" || v.modulePath != "example.com/proj/cmd" {
+		t.Errorf("read module %q from %q", v.modulePath, v.goModDir)
+	}
+}
+
+func TestReadGoModMissing(t *testing.T) {
+	v := readTestGoMod(t, map[string]string{
+		"cmd/tool/main.go": "package main\n",
+	}, "cmd/tool")
+
+	if v.modulePath != "" {
+		t.Errorf("read module %q", v.modulePath)
+	}
+}
@@ -0,0 +1,140 @@
+package vendetta
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A package of the project imported by its full import path, however
+// deep, is found at its directory within the repo.
+func TestProvidesDeepSubpackage(t *testing.T) {
+	v := testVendetta(t, map[string]string{
+		"main.go":                  "package main\n",
+		"pkg/util/deep/er/x.go":    "package er\n",
+		"other/thing/sub/y.go":     "package sub\n",
+		"vendor/github.com/a/b.go": "package a\n",
+	})
+	gp := &goPath{prefixes: map[string]struct{}{
+		"github.com/me/thing": {},
+		"example.com/thing":   {},
+	}}
+
+	for _, c := range []struct {
+		pkg, dir string
+		found    bool
+	}{
+		{"github.com/me/thing/pkg/util/deep/er", "pkg/util/deep/er", true},
+		{"github.com/me/thing/pkg/util/deep", "", false},
+		{"example.com/thing/other/thing/sub", "other/thing/sub", true},
+		{"example.com/thing/pkg/util/deep/er", "pkg/util/deep/er", true},
+		{"github.com/me/thing/other/sub", "", false},
+		{"github.com/me/things/pkg/util/deep/er", "", false},
+		{"github.com/a", "", false},
+	} {
+		found, dir, err := gp.provides(c.pkg, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found != c.found || found && dir != filepath.FromSlash(c.dir) {
+			t.Errorf("provides(%q) = %v, %q, want %v, %q",
+				c.pkg, found, dir, c.found, c.dir)
+		}
+	}
+}
+
+func TestRemovePrefixBoundary(t *testing.T) {
+	gp := &goPath{prefixes: map[string]struct{}{
+		"github.com/x/bar":    {},
+		"github.com/x/barbaz": {},
+	}}
+
+	for _, c := range []struct {
+		pkg, rest string
+		matched   bool
+	}{
+		{"github.com/x/bar", "", true},
+		{"github.com/x/bar/y", "y", true},
+		{"github.com/x/barbaz", "", true},
+		{"github.com/x/barbaz/y", "y", true},
+		{"github.com/x/barb", "", false},
+		{"github.com/x/bar-x/y", "", false},
+		{"github.com/x", "", false},
+	} {
+		matched, rest := gp.removePrefix(c.pkg)
+		if matched != c.matched || rest != c.rest {
+			t.Errorf("removePrefix(%q) = %v, %q, want %v, %q",
+				c.pkg, matched, rest, c.matched, c.rest)
+		}
+	}
+}
+
+// The root project's goPath is at the top level of the repo, so its
+// packages are found there, even if a copy is lying around under
+// vendor/.
+func TestProvidesRootProject(t *testing.T) {
+	v := testVendetta(t, map[string]string{
+		"main.go":         "package main\n",
+		"sub/deeper/d.go": "package deeper\n",
+		"vendor/example.com/proj/sub/deeper/d.go": "package deeper\n",
+	})
+	gp := &goPath{prefixes: map[string]struct{}{"example.com/proj": {}}}
+
+	for _, c := range []struct {
+		pkg, dir string
+	}{
+		{"example.com/proj", ""},
+		{"example.com/proj/sub/deeper", "sub/deeper"},
+	} {
+		found, dir, err := gp.provides(c.pkg, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !found || dir != filepath.FromSlash(c.dir) {
+			t.Errorf("provides(%q) = %v, %q, want %q",
+				c.pkg, found, dir, c.dir)
+		}
+	}
+}
+
+// A subpackage of the root project imported by its full import path
+// gets scanned in place, so its dependencies are vendored, but it
+// isn't vendored itself.
+func TestRunRootSubpackage(t *testing.T) {
+	gitTestEnv(t)
+	tmp := t.TempDir()
+	makeGitRepo(t, filepath.Join(tmp, "d"), map[string]string{
+		"d.go": "package d\n",
+	})
+
+	proj := filepath.Join(tmp, "proj")
+	makeGitRepo(t, proj, map[string]string{
+		"main.go":         "package main\n\nimport _ \"example.com/proj/sub/deeper\"\n\nfunc main() {}\n",
+		"sub/deeper/x.go": "package deeper\n\nimport _ \"example.com/d\"\n",
+		configFile: `{"rules": [{"match": "^example\\.com/d$", "url": "` +
+			filepath.ToSlash(filepath.Join(tmp, "d")) + `", "rootSegments": 2}]}`,
+	})
+
+	var out bytes.Buffer
+	res, err := Run(Options{
+		Root:        proj,
+		ProjectName: "example.com/proj",
+		Stdout:      &out,
+		Stderr:      &out,
+	})
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+
+	want := filepath.Join("vendor", "example.com", "d")
+	if len(res.Added) != 1 || res.Added[0] != want {
+		t.Errorf("added %v, want [%s]\n%s", res.Added, want, out.String())
+	}
+
+	if _, err := os.Stat(filepath.Join(proj, "vendor", "example.com", "proj")); !os.IsNotExist(err) {
+		t.Errorf("the project was vendored into itself (%v)", err)
+	}
+}
@@ -0,0 +1,114 @@
+package vendetta
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The default GOPROXY setting of the go tool
+const defaultGoProxy = "https://proxy.golang.org,direct"
+
+// The version information served by a module proxy, from the
+// $module/@latest and $module/@v/$version.info endpoints.
+type proxyInfo struct {
+	Version string
+}
+
+// With -goproxy, ask the module proxies in GOPROXY which version of
+// the module at loc to check out: the version required by go.mod if
+// there is one, and otherwise the latest.  The version becomes the tag
+// to check out after cloning the repo.  If the proxies don't know the
+// module, the repo's default branch is used as usual.
+func (v *vendetta) proxyVersion(loc *repoLocation) {
+	module := loc.root
+	if loc.major != "" {
+		module += "/" + loc.major
+	}
+
+	endpoint := "@latest"
+	if version := v.requires[module]; version != "" {
+		endpoint = "@v/" + escapeModulePath(version) + ".info"
+	}
+
+	info, err := queryGoProxy(v.goProxy, escapeModulePath(module)+"/"+endpoint)
+	if err != nil {
+		fmt.Fprintf(v.Stdout, "Warning: could not get the version of %s from GOPROXY, so using the default branch (%v)\n",
+			module, err)
+		return
+	}
+
+	if info.Version == "" {
+		return
+	}
+
+	// A pseudo-version identifies a commit, rather than a tag.
+	// Modules from before the repo adopted modules have
+	// +incompatible versions, but the tags lack that suffix.
+	loc.tag = strings.TrimSuffix(info.Version, "+incompatible")
+	if m := pseudoVersionRE.FindStringSubmatch(loc.tag); m != nil {
+		loc.tag = m[1]
+	}
+}
+
+// Fetch a path from the module proxies in a GOPROXY setting, in order.
+// As with the go tool, after a proxy in a comma-separated list fails
+// with "not found" or "gone", the next one is tried, but after a
+// proxy followed by '|' fails for any reason, the next one is tried.
+// "direct" and "off" end the list, as we don't fetch modules directly
+// from their repos here.
+func queryGoProxy(goproxy, path string) (*proxyInfo, error) {
+	err := fmt.Errorf("no module proxy in GOPROXY")
+	for goproxy != "" {
+		proxy, sep := goproxy, byte(0)
+		if i := strings.IndexAny(goproxy, ",|"); i >= 0 {
+			proxy, sep = goproxy[:i], goproxy[i]
+			goproxy = goproxy[i+1:]
+		} else {
+			goproxy = ""
+		}
+
+		switch proxy = strings.TrimSpace(proxy); proxy {
+		case "":
+			continue
+		case "direct", "off":
+			return nil, err
+		}
+
+		var body []byte
+		body, err = httpGET(strings.TrimSuffix(proxy, "/") + "/" + path)
+		if err == nil {
+			var info proxyInfo
+			if err := json.Unmarshal(body, &info); err != nil {
+				return nil, fmt.Errorf("%s/%s: %v", proxy, path, err)
+			}
+
+			return &info, nil
+		}
+
+		he, ok := err.(*httpError)
+		notFound := ok && (he.statusCode == 404 || he.statusCode == 410)
+		if sep != '|' && !notFound {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// Escape a module path or version for use in a module proxy URL, by
+// replacing each upper-case letter with '!' and its lower-case form.
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
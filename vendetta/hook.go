@@ -0,0 +1,60 @@
+package vendetta
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// With -after-add, run the given shell command at the top level of
+// the repo once the new submodules have been added, for custom
+// post-processing such as code generation.  VENDETTA_ADDED holds the
+// directories of the new submodules, and VENDETTA_ADDED_PACKAGES
+// their import paths, one per line.  If nothing was added, the
+// command isn't run.
+func (v *vendetta) runAfterAdd() error {
+	if v.AfterAdd == "" || len(v.added) == 0 {
+		return nil
+	}
+
+	var dirs, pkgs []string
+	for _, dir := range v.added {
+		dirs = append(dirs, pathToPackage(dir))
+		if isSubpath(dir, "vendor") && dir != "vendor" {
+			pkgs = append(pkgs, pathToPackage(dir[len("vendor")+1:]))
+		}
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", v.AfterAdd)
+	} else {
+		cmd = exec.Command("sh", "-c", v.AfterAdd)
+	}
+
+	cmd.Dir = v.rootDir
+	cmd.Stdout = v.Stdout
+	cmd.Stderr = v.Stderr
+	cmd.Env = append(os.Environ(),
+		"VENDETTA_ADDED="+strings.Join(dirs, "\n"),
+		"VENDETTA_ADDED_PACKAGES="+strings.Join(pkgs, "\n"))
+
+	fmt.Fprintf(v.Stderr, "Running the -after-add command\n")
+	v.traceStart(cmd)
+	err := cmd.Run()
+	v.traceDone(cmd, err)
+	if err == nil {
+		return nil
+	}
+
+	err = fmt.Errorf("The -after-add command failed: %s (%v)",
+		v.AfterAdd, err)
+	if !v.KeepGoing {
+		return err
+	}
+
+	v.keepGoing(err)
+	return nil
+}
@@ -0,0 +1,360 @@
+package vendetta
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// A repoLocation says where the repo holding a package lives.
+type repoLocation struct {
+	// root is the import path corresponding to the root of the
+	// repo
+	root string
+
+	// url is the URL to clone the repo from
+	url string
+
+	// branch is the branch to track, and tag is a tag to check
+	// out after cloning.  Normally these are empty, meaning the
+	// default branch of the repo.
+	branch string
+	tag    string
+
+	// major is the major version suffix (e.g. "v3") of the
+	// module path wanted from the repo, if any
+	major string
+}
+
+// hostingSites maps host names to functions that work out where the
+// repo for a package on that host lives, given the elements of its
+// import path.  This avoids a round trip to query go-import meta tags
+// for well-known hosts.
+var hostingSites = map[string]func(bits []string) (repoLocation, error){
+	"github.com": userRepoHost(),
+
+	// Gitea-based forges
+	"codeberg.org": userRepoHost(),
+	"gitea.com":    userRepoHost(),
+
+	// Repos on bitbucket.org might be hg repos, so its
+	// go-import meta tags are needed to tell.
+	"bitbucket.org": func(bits []string) (repoLocation, error) {
+		return repoLocation{}, errUseMetaTags
+	},
+
+	"gopkg.in": func(bits []string) (repoLocation, error) {
+		// Import paths are gopkg.in/pkg.vN (for
+		// github.com/go-pkg/pkg) or gopkg.in/user/pkg.vN
+		n := 3
+		if len(bits) >= 2 && gopkgInRE.MatchString(bits[1]) {
+			n = 2
+		}
+
+		return fixedRoot(n, func(root string) string {
+			return "https://" + root
+		})(bits)
+	},
+
+	"go4.org": fixedRoot(1, func(string) string {
+		return "https://github.com/go4org/go4"
+	}),
+
+	"rsc.io": fixedRoot(2, func(root string) string {
+		return "https://github.com/rsc/" + root[len("rsc.io/"):]
+	}),
+
+	"dev.azure.com": func(bits []string) (repoLocation, error) {
+		// Azure DevOps import paths look like
+		// dev.azure.com/org/project/_git/repo, where the repo
+		// name may have a .git suffix.  Other forms are
+		// ambiguous, so leave them to the go-import meta tags.
+		if len(bits) < 5 || bits[3] != "_git" {
+			return repoLocation{}, errUseMetaTags
+		}
+
+		root := strings.Join(bits[:5], "/")
+		return repoLocation{
+			root: root,
+			url:  "https://" + strings.TrimSuffix(root, ".git"),
+		}, nil
+	},
+}
+
+// Look up the hostingSites function for a host.  Host names are
+// case-insensitive, so GitHub.com is github.com.
+func hostingSite(host string) func([]string) (repoLocation, error) {
+	return hostingSites[strings.ToLower(host)]
+}
+
+// A hostingSites function returns errUseMetaTags when it can't tell
+// where the repo lives, so the go-import meta tags should be
+// consulted as for other hosts.
+var errUseMetaTags = errors.New("use go-import meta tags")
+
+var gopkgInRE = regexp.MustCompile(`^[a-zA-Z0-9_.-]+\.v[0-9]+(-unstable)?$`)
+
+// userRepoHost returns a hostingSites function for a host where
+// import paths look like host/user/repo, and the repo can be cloned
+// from https://host/user/repo.
+func userRepoHost() func([]string) (repoLocation, error) {
+	return fixedRoot(3, func(root string) string {
+		return "https://" + root
+	})
+}
+
+// fixedRoot returns a hostingSites function for a host where repo
+// roots always consist of the first n elements of the import path.
+func fixedRoot(n int, url func(root string) string) func([]string) (repoLocation, error) {
+	return func(bits []string) (repoLocation, error) {
+		if len(bits) < n {
+			return repoLocation{}, fmt.Errorf("%s package name %s seems to be truncated", bits[0], strings.Join(bits, "/"))
+		}
+
+		root := strings.Join(bits[:n], "/")
+		return repoLocation{root: root, url: url(root)}, nil
+	}
+}
+
+// Apply the -branch and -default-branch options to a repo.  A -branch
+// setting applies to repos under its import path, with the longest
+// match winning.  The branch replaces any branch or tag that we
+// worked out for the repo.  -default-branch only applies when nothing
+// else selected a branch or tag.
+func (v *vendetta) selectBranch(loc *repoLocation) {
+	match := ""
+	for prefix := range v.Branches {
+		if isSubpackage(loc.root, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+
+	switch {
+	case match != "":
+		loc.branch = v.Branches[match]
+		loc.tag = ""
+	case loc.branch == "" && loc.tag == "":
+		loc.branch = v.DefaultBranch
+	}
+}
+
+// Check that the host of a clone URL is permitted by -allow-hosts and
+// -only-host.
+func (v *vendetta) checkHostAllowed(pkg, repoURL string) error {
+	host := urlHost(repoURL)
+	if v.OnlyHost != "" && !strings.EqualFold(host, v.OnlyHost) {
+		return fmt.Errorf("Package %s would be obtained from %s, but -only-host only permits the host '%s'", pkg, repoURL, v.OnlyHost)
+	}
+
+	if len(v.AllowHosts) == 0 {
+		return nil
+	}
+
+	for _, allowed := range v.AllowHosts {
+		if strings.EqualFold(host, allowed) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Package %s would be obtained from %s, but the host '%s' is not permitted by -allow-hosts", pkg, repoURL, host)
+}
+
+// Extract the host name from a git repo URL.  As well as proper URLs,
+// this handles the scp-like syntax (e.g. git@github.com:user/repo).
+func urlHost(repoURL string) string {
+	if !strings.Contains(repoURL, "://") {
+		if colon := strings.Index(repoURL, ":"); colon >= 0 {
+			host := repoURL[:colon]
+			if at := strings.LastIndex(host, "@"); at >= 0 {
+				host = host[at+1:]
+			}
+
+			return host
+		}
+	}
+
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+// Normalize a git repo URL so that different ways of referring to
+// the same repo can be compared, e.g. https://github.com/user/repo
+// and git@github.com:user/repo.git.
+func normalizeRepoURL(repoURL string) string {
+	path := repoURL
+	if i := strings.Index(repoURL, "://"); i >= 0 {
+		if u, err := url.Parse(repoURL); err == nil {
+			path = u.Path
+		}
+	} else if colon := strings.Index(repoURL, ":"); colon >= 0 {
+		path = repoURL[colon+1:]
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	return strings.ToLower(urlHost(repoURL)) + "/" + path
+}
+
+// The GitHub mirrors of repos on googlesource.com, keyed by the host
+// and path of the googlesource.com repo.  Repos on go.googlesource.com
+// (the golang.org/x repos) are mirrored under github.com/golang with
+// the same names, so aren't listed.
+var googlesourceMirrors = map[string]string{
+	"code.googlesource.com/gocloud":              "https://github.com/googleapis/google-cloud-go",
+	"code.googlesource.com/google-api-go-client": "https://github.com/googleapis/google-api-go-client",
+}
+
+// Find the GitHub mirror of a repo on googlesource.com, to fall back
+// to when it can't be cloned from there (as happens on some
+// networks).
+func githubMirror(repoURL string) (string, bool) {
+	norm := normalizeRepoURL(repoURL)
+	if mirror, ok := googlesourceMirrors[norm]; ok {
+		return mirror, true
+	}
+
+	const golang = "go.googlesource.com/"
+	if strings.HasPrefix(norm, golang) && len(norm) > len(golang) &&
+		!strings.Contains(norm[len(golang):], "/") {
+		return "https://github.com/golang/" + norm[len(golang):], true
+	}
+
+	return "", false
+}
+
+// gopkg.in serves packages from GitHub repos, selecting the branch or
+// tag that matches the major version in the import path.  Rather than
+// cloning through gopkg.in, find the upstream repo and ref from the
+// go-source meta tag it serves.  If that doesn't work out, we stick
+// with gopkg.in.
+func (v *vendetta) gopkgInUpstreamRepo(loc repoLocation) repoLocation {
+	src, err := fetchGoSource(loc.root)
+	if err == nil && src.dir != "" {
+		// The directory template looks like
+		// https://github.com/go-yaml/yaml/tree/v2.4.0{/dir}
+		tmpl := strings.TrimSuffix(src.dir, "{/dir}")
+		if i := strings.LastIndex(tmpl, "/tree/"); i >= 0 {
+			up := repoLocation{root: loc.root, url: tmpl[:i]}
+			ref := tmpl[i+len("/tree/"):]
+			isBranch, err := v.remoteHasBranch(up.url, ref)
+			if err == nil {
+				if isBranch {
+					up.branch = ref
+				} else {
+					up.tag = ref
+				}
+
+				return up
+			}
+		}
+	}
+
+	fmt.Fprintf(v.Stderr, "Warning: could not find upstream repo for %s, so using %s\n", loc.root, loc.url)
+	return loc
+}
+
+func (v *vendetta) remoteHasBranch(repoURL, branch string) (bool, error) {
+	heads, err := v.popen("git", "ls-remote", "--heads", repoURL,
+		"refs/heads/"+branch)
+	if err != nil {
+		return false, err
+	}
+
+	defer heads.close()
+
+	found := false
+	for heads.Scan() {
+		found = true
+	}
+
+	return found, heads.close()
+}
+
+// A goSource holds the contents of a go-source meta tag (see
+// https://github.com/golang/gddo/wiki/Source-Code-Links).
+type goSource struct {
+	prefix, home, dir, file string
+}
+
+// Fetch the go-source meta tag for an import path.
+func fetchGoSource(importPath string) (goSource, error) {
+	_, body, err := httpsOrHTTP(importPath, secure)
+	if err != nil {
+		return goSource{}, err
+	}
+
+	defer body.Close()
+
+	for _, f := range parseMetaTags(body, "go-source") {
+		if len(f) == 4 && (f[0] == importPath ||
+			strings.HasPrefix(importPath, f[0]+"/")) {
+			return goSource{f[0], f[1], f[2], f[3]}, nil
+		}
+	}
+
+	return goSource{}, fmt.Errorf("no go-source meta tag found for %s", importPath)
+}
+
+// Extract the fields of the content of meta tags with the given name
+// from the <head> of an HTML document.  This is like
+// parseMetaGoImports in reporoot.go, but for any kind of meta tag.
+func parseMetaTags(r io.Reader, name string) [][]string {
+	var res [][]string
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charsetReader
+	d.Strict = false
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			return res
+		}
+
+		switch e := t.(type) {
+		case xml.StartElement:
+			if strings.EqualFold(e.Name.Local, "body") {
+				return res
+			}
+
+			if strings.EqualFold(e.Name.Local, "meta") &&
+				attrValue(e.Attr, "name") == name {
+				res = append(res, strings.Fields(attrValue(e.Attr, "content")))
+			}
+		case xml.EndElement:
+			if strings.EqualFold(e.Name.Local, "head") {
+				return res
+			}
+		}
+	}
+}
+
+// Check whether the repo at loc has moved, i.e. the go-import meta
+// tag served for its root import path gives a different import path.
+// E.g. GitHub does this for renamed repos.  If so, we clone from the
+// new location, but keep the directory layout according to the old
+// import path, because that is what the code importing it uses.
+func (v *vendetta) checkMoved(loc repoLocation) repoLocation {
+	_, imports, err := metaImportsForPrefix(loc.root, secure)
+	if err != nil || len(imports) != 1 {
+		return loc
+	}
+
+	mi := imports[0]
+	if mi.Prefix == loc.root || strings.HasPrefix(loc.root, mi.Prefix+"/") {
+		return loc
+	}
+
+	fmt.Fprintf(v.Stdout, "Warning: %s seems to have moved to %s; the code importing it may need updating\n",
+		loc.root, mi.Prefix)
+	if mi.VCS == "git" && strings.Contains(mi.RepoRoot, "://") {
+		loc.url = mi.RepoRoot
+	}
+
+	return loc
+}
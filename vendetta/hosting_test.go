@@ -0,0 +1,67 @@
+package vendetta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHostingSiteCase(t *testing.T) {
+	for _, c := range []struct {
+		pkg, root, url string
+	}{
+		{"github.com/foo/bar/baz", "github.com/foo/bar", "https://github.com/foo/bar"},
+		{"GitHub.com/foo/bar/baz", "GitHub.com/foo/bar", "https://GitHub.com/foo/bar"},
+		{"GITHUB.COM/Foo/Bar", "GITHUB.COM/Foo/Bar", "https://GITHUB.COM/Foo/Bar"},
+		{"Codeberg.org/foo/bar", "Codeberg.org/foo/bar", "https://Codeberg.org/foo/bar"},
+		{"Go4.org/syncutil", "Go4.org", "https://github.com/go4org/go4"},
+		{"Dev.Azure.com/org/proj/_git/repo/pkg", "Dev.Azure.com/org/proj/_git/repo", "https://Dev.Azure.com/org/proj/_git/repo"},
+	} {
+		bits := strings.Split(c.pkg, "/")
+		site := hostingSite(bits[0])
+		if site == nil {
+			t.Errorf("no hosting site for %s", c.pkg)
+			continue
+		}
+
+		loc, err := site(bits)
+		if err != nil {
+			t.Errorf("%s: %v", c.pkg, err)
+			continue
+		}
+
+		if loc.root != c.root || loc.url != c.url {
+			t.Errorf("%s: got root %q url %q, want root %q url %q",
+				c.pkg, loc.root, loc.url, c.root, c.url)
+		}
+	}
+}
+
+func TestHostingSiteUnknown(t *testing.T) {
+	for _, host := range []string{"example.com", "github.com.example.com", "GitHub.co", ""} {
+		if hostingSite(host) != nil {
+			t.Errorf("unexpected hosting site for %q", host)
+		}
+	}
+
+	// Bitbucket repos are found through their meta tags, whatever
+	// the case of the host.
+	site := hostingSite("BitBucket.org")
+	if site == nil {
+		t.Fatal("no hosting site for BitBucket.org")
+	}
+
+	if _, err := site([]string{"BitBucket.org", "foo", "bar"}); err != errUseMetaTags {
+		t.Errorf("BitBucket.org: got %v, want errUseMetaTags", err)
+	}
+}
+
+// checkProjectName also finds well-known hosts case-insensitively.
+func TestCheckProjectNameHostCase(t *testing.T) {
+	if err := checkProjectName("GitHub.com/foo"); err == nil {
+		t.Error("GitHub.com/foo accepted as a project name")
+	}
+
+	if err := checkProjectName("GitHub.com/foo/bar"); err != nil {
+		t.Error(err)
+	}
+}
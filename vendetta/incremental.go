@@ -0,0 +1,110 @@
+package vendetta
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// With -incremental, scan only the packages of the project in
+// directories that contain changes relative to Options.IncrementalRef
+// (including untracked files), rather than the whole project.
+//
+// Packages that import a changed package don't need scanning again:
+// any new dependencies reached through the changed package are found
+// by resolving its own imports.  But as unchanged packages are not
+// scanned, we can't tell which submodules are unused, so this mode
+// can't be combined with pruning or listing.
+func (v *vendetta) scanChangedDirs() ([]rootPackage, error) {
+	dirs, err := v.changedDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []rootPackage
+	for _, dir := range dirs {
+		if !v.inScannedProject(dir) {
+			continue
+		}
+
+		// The changes may include deleting the directory
+		fi, err := os.Stat(v.realDir(dir))
+		if err != nil || !fi.IsDir() {
+			continue
+		}
+
+		pkg, err := v.loadRootPackage(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if pkg != nil {
+			pkgs = append(pkgs, rootPackage{dir, pkg})
+		}
+	}
+
+	return pkgs, nil
+}
+
+// Find the directories containing files that differ from
+// IncrementalRef, or are untracked.
+func (v *vendetta) changedDirs() ([]string, error) {
+	ref := v.IncrementalRef
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	set := make(map[string]struct{})
+	collect := func(args ...string) error {
+		files, err := v.popen("git", args...)
+		if err != nil {
+			return err
+		}
+
+		defer files.close()
+
+		files.Split(splitNUL)
+		for files.Scan() {
+			set[parentDir(filepath.FromSlash(files.Text()))] = struct{}{}
+		}
+
+		return files.close()
+	}
+
+	if err := collect("diff", "--name-only", "-z", ref, "--"); err != nil {
+		return nil, err
+	}
+
+	if err := collect("ls-files", "-z", "--others", "--exclude-standard"); err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for dir := range set {
+		dirs = append(dirs, dir)
+	}
+
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// Is dir one that scanRootProject would scan?
+func (v *vendetta) inScannedProject(dir string) bool {
+	if !isSubpath(dir, v.scanDir) {
+		return false
+	}
+
+	rel := strings.TrimPrefix(dir[len(v.scanDir):], string(os.PathSeparator))
+	if rel == "" {
+		return true
+	}
+
+	for i, elem := range strings.Split(rel, string(os.PathSeparator)) {
+		if v.skipProjectDir(elem, i == 0 && v.scanDir == "") {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,119 @@
+package vendetta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// License describes the license files found at the top level of a
+// submodule, with -list-licenses.
+type License struct {
+	// Files holds the names of the license files.  It is empty
+	// if there are none, which is worth looking into.
+	Files []string `json:"files"`
+
+	// Guess holds best-effort guesses at the SPDX identifiers of
+	// the licenses, from the contents of the files.
+	Guess []string `json:"guess,omitempty"`
+}
+
+// The names of license files start with one of these (ignoring case),
+// e.g. LICENSE, LICENSE.md, LICENSE-MIT or COPYING.LESSER.
+var licenseFilePrefixes = []string{"LICENSE", "LICENCE", "COPYING",
+	"UNLICENSE"}
+
+// Phrases that identify common licenses, with their SPDX identifiers.
+// These are tried in order, and the first match wins, so more
+// specific phrases come first.  They are matched against the text of
+// a license file with whitespace collapsed.
+var licensePhrases = []struct {
+	phrase string
+	spdx   string
+}{
+	{"GNU AFFERO GENERAL PUBLIC LICENSE Version 3", "AGPL-3.0"},
+	{"GNU LESSER GENERAL PUBLIC LICENSE Version 3", "LGPL-3.0"},
+	{"GNU LESSER GENERAL PUBLIC LICENSE Version 2.1", "LGPL-2.1"},
+	{"GNU GENERAL PUBLIC LICENSE Version 3", "GPL-3.0"},
+	{"GNU GENERAL PUBLIC LICENSE Version 2", "GPL-2.0"},
+	{"Mozilla Public License Version 2.0", "MPL-2.0"},
+	{"Mozilla Public License, version 2.0", "MPL-2.0"},
+	{"Apache License Version 2.0", "Apache-2.0"},
+	{"Apache License, Version 2.0", "Apache-2.0"},
+	{"Permission is hereby granted, free of charge", "MIT"},
+	{"Permission to use, copy, modify, and/or distribute this software for any purpose", "ISC"},
+	{"Neither the name", "BSD-3-Clause"},
+	{"Redistribution and use in source and binary forms", "BSD-2-Clause"},
+	{"This is free and unencumbered software released into the public domain", "Unlicense"},
+	{"Eclipse Public License - v 2.0", "EPL-2.0"},
+	{"CC0 1.0 Universal", "CC0-1.0"},
+}
+
+// Look for license files at the top level of a submodule, returning
+// nil if it isn't checked out.
+func findLicense(dir string) *License {
+	lic := License{Files: []string{}}
+	err := readDir(dir, func(fi os.FileInfo) bool {
+		if fi.IsDir() || !isLicenseFile(fi.Name()) {
+			return true
+		}
+
+		lic.Files = append(lic.Files, fi.Name())
+		if spdx := guessLicense(filepath.Join(dir, fi.Name())); spdx != "" {
+			lic.Guess = append(lic.Guess, spdx)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil
+	}
+
+	sort.Strings(lic.Files)
+	sort.Strings(lic.Guess)
+	lic.Guess = uniqStrings(lic.Guess)
+	return &lic
+}
+
+func isLicenseFile(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, prefix := range licenseFilePrefixes {
+		if strings.HasPrefix(upper, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Guess the SPDX identifier of the license in a file, or return ""
+// if it isn't recognized.
+func guessLicense(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	text := strings.Join(strings.Fields(string(data)), " ")
+	for _, lp := range licensePhrases {
+		if strings.Contains(text, lp.phrase) {
+			return lp.spdx
+		}
+	}
+
+	return ""
+}
+
+// Remove adjacent duplicates from a sorted list of strings.
+func uniqStrings(a []string) []string {
+	res := a[:0]
+	for i, s := range a {
+		if i == 0 || s != a[i-1] {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,117 @@
+package vendetta
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// In module mode, the import path of a module with a major version
+// of 2 or more ends in /vN, e.g. github.com/foo/bar/v3.  That
+// element is not part of the path of the repo root, and the repo can
+// be laid out in one of two ways: the module can be in a vN
+// subdirectory, or at the top level (on the default branch, or on a
+// vN branch).  In the second case, the go tool expects to find the
+// module in vendor/github.com/foo/bar/v3, not at the repo root.
+//
+// If the element of the import path pkg following the repo root is
+// a major version suffix, return it.
+func majorSuffix(pkg, root string) string {
+	if !isSubpackage(pkg, root) || pkg == root {
+		return ""
+	}
+
+	elem := strings.SplitN(pkg[len(root)+1:], "/", 2)[0]
+	if !majorVersionRE.MatchString("/" + elem) {
+		return ""
+	}
+
+	return elem
+}
+
+// Once the repo for a module with a major version suffix has been
+// cloned, we can see how it is laid out.  If the module is at the
+// top level, move the clone down into the vN directory, and return
+// the new directory of the submodule.
+func (v *vendetta) placeMajorVersion(c *pendingClone) (string, error) {
+	major := c.loc.major
+	if major == "" {
+		return c.dir, nil
+	}
+
+	modPath := c.loc.root + "/" + major
+	if _, err := os.Stat(filepath.Join(v.realDir(c.dir), major)); err == nil {
+		// The module is in a subdirectory
+		return c.dir, nil
+	}
+
+	if readModulePath(filepath.Join(v.realDir(c.dir), "go.mod")) != modPath {
+		// Look for a vN branch, unless a branch was chosen
+		if c.loc.branch != "" || c.loc.tag != "" ||
+			v.git("-C", c.dir, "checkout", "-q", major) != nil ||
+			readModulePath(filepath.Join(v.realDir(c.dir), "go.mod")) != modPath {
+			fmt.Fprintf(v.Stdout, "Warning: %s was cloned for the module %s, but has neither a %s directory nor a go.mod for that module\n",
+				c.loc.url, modPath, major)
+			return c.dir, nil
+		}
+
+		c.loc.branch = major
+	}
+
+	// Move the clone into a vN subdirectory of where it was
+	realDir := v.realDir(c.dir)
+	tmp := realDir + ".vendetta-tmp"
+	if err := os.Rename(realDir, tmp); err != nil {
+		return "", err
+	}
+
+	if err := os.Mkdir(realDir, 0777); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(c.dir, major)
+	return dir, os.Rename(tmp, v.realDir(dir))
+}
+
+// The major version suffix of the module that a submodule provides.
+// Until it is cloned, that is the one it was added for.  After that,
+// a module at the top level of its repo has been moved into the vN
+// directory, so the suffix is the last element of the submodule's
+// directory.  A repo with the module in a vN subdirectory stays at the
+// repo root, and serves every major version.
+func (sm *submodule) majorVersion() string {
+	if sm.pending {
+		return sm.major
+	}
+
+	elem := path.Base(filepath.ToSlash(sm.dir))
+	if !majorVersionRE.MatchString("/" + elem) {
+		return ""
+	}
+
+	return elem
+}
+
+// Read the module path from a go.mod file, returning "" if there is
+// none.
+func readModulePath(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+
+	return ""
+}
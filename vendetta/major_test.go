@@ -0,0 +1,141 @@
+package vendetta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMajorSuffix(t *testing.T) {
+	for _, c := range []struct {
+		pkg, root, want string
+	}{
+		{"github.com/foo/bar/v3", "github.com/foo/bar", "v3"},
+		{"github.com/foo/bar/v3/x/y", "github.com/foo/bar", "v3"},
+		{"github.com/foo/bar/v12/x", "github.com/foo/bar", "v12"},
+		{"github.com/foo/bar/x", "github.com/foo/bar", ""},
+		{"github.com/foo/bar/v1/x", "github.com/foo/bar", ""},
+		{"github.com/foo/bar/v0/x", "github.com/foo/bar", ""},
+		{"github.com/foo/bar/v01/x", "github.com/foo/bar", ""},
+		{"github.com/foo/bar/vx/x", "github.com/foo/bar", ""},
+		{"github.com/foo/bar/x/v3", "github.com/foo/bar", ""},
+		{"github.com/foo/bar", "github.com/foo/bar", ""},
+		{"github.com/foo/barbaz/v3", "github.com/foo/bar", ""},
+	} {
+		if got := majorSuffix(c.pkg, c.root); got != c.want {
+			t.Errorf("majorSuffix(%q, %q) = %q, want %q",
+				c.pkg, c.root, got, c.want)
+		}
+	}
+}
+
+// Set up a clone of a repo with the given files at vendor/example.com/foo,
+// as cloneRepo would leave it, and call placeMajorVersion on it.
+func placeClone(t *testing.T, files map[string]string, branches map[string]map[string]string) (*vendetta, pendingClone, string) {
+	t.Helper()
+	gitTestEnv(t)
+	tmp := t.TempDir()
+	dir := filepath.Join("vendor", "example.com", "foo")
+	repo := filepath.Join(tmp, dir)
+	makeGitRepo(t, repo, files)
+	for branch, files := range branches {
+		runGit(t, repo, "checkout", "-q", "-b", branch)
+		writeFiles(t, repo, files)
+		runGit(t, repo, "add", "-A")
+		runGit(t, repo, "commit", "-q", "-m", branch)
+		runGit(t, repo, "checkout", "-q", "-")
+	}
+
+	v := &vendetta{Options: &Options{Stdout: ioutil.Discard,
+		Stderr: ioutil.Discard}, rootDir: tmp}
+	c := pendingClone{loc: repoLocation{root: "example.com/foo",
+		url: "https://example.com/foo.git", major: "v3"}, dir: dir}
+	got, err := v.placeMajorVersion(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v, c, got
+}
+
+func TestPlaceMajorVersionSubdirectory(t *testing.T) {
+	v, c, got := placeClone(t, map[string]string{
+		"go.mod":    "module example.com/foo\n",
+		"v3/go.mod": "module example.com/foo/v3\n",
+	}, nil)
+	if got != c.dir {
+		t.Errorf("placeMajorVersion moved the clone to %s", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(v.realDir(got), "v3", "go.mod")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlaceMajorVersionTopLevel(t *testing.T) {
+	v, c, got := placeClone(t, map[string]string{
+		"go.mod": "module example.com/foo/v3\n",
+	}, nil)
+	want := filepath.Join(c.dir, "v3")
+	if got != want {
+		t.Fatalf("placeMajorVersion returned %s, want %s", got, want)
+	}
+
+	if readModulePath(filepath.Join(v.realDir(want), "go.mod")) != "example.com/foo/v3" {
+		t.Errorf("no go.mod for the module in %s", want)
+	}
+
+	if _, err := os.Stat(filepath.Join(v.realDir(want), ".git")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlaceMajorVersionBranch(t *testing.T) {
+	v, c, got := placeClone(t, map[string]string{
+		"go.mod": "module example.com/foo\n",
+	}, map[string]map[string]string{
+		"v3": {"go.mod": "module example.com/foo/v3\n"},
+	})
+	want := filepath.Join(c.dir, "v3")
+	if got != want {
+		t.Fatalf("placeMajorVersion returned %s, want %s", got, want)
+	}
+
+	if c.loc.branch != "v3" {
+		t.Errorf("branch is %q, want v3", c.loc.branch)
+	}
+
+	if readModulePath(filepath.Join(v.realDir(want), "go.mod")) != "example.com/foo/v3" {
+		t.Errorf("the v3 branch is not checked out in %s", want)
+	}
+}
+
+// A repo cloned for one major version of a module doesn't stand in
+// for another major version that had to be placed separately.
+func TestUseSubmoduleWithURLMajor(t *testing.T) {
+	url := "https://example.com/foo.git"
+	v := &vendetta{}
+	v.addSubmodule(submodule{dir: filepath.Join("vendor", "example.com", "foo", "v3"),
+		url: url})
+	v.addSubmodule(submodule{dir: filepath.Join("vendor", "example.com", "bar"),
+		url: "https://example.com/bar.git", major: "v2", pending: true})
+
+	for _, c := range []struct {
+		url, major string
+		found      bool
+	}{
+		{url, "v3", true},
+		{url, "", false},
+		{url, "v4", false},
+		{"https://example.com/foo", "v3", true},
+		{"https://example.com/bar.git", "v2", true},
+		{"https://example.com/bar.git", "", false},
+	} {
+		sm := v.useSubmoduleWithURL(c.url, c.major)
+		if (sm != nil) != c.found {
+			t.Errorf("useSubmoduleWithURL(%q, %q) = %v, want found=%v",
+				c.url, c.major, sm, c.found)
+		}
+	}
+}
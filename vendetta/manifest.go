@@ -0,0 +1,60 @@
+package vendetta
+
+import (
+	"fmt"
+	"sort"
+)
+
+// With -manifest, compare the dependencies found by the walk with the
+// import paths listed in the manifest file, and warn about the
+// differences: new dependencies that aren't listed, and listed ones
+// that are no longer imported.  This catches unexpected transitive
+// dependencies.  With -check, any difference is an error.
+func (v *vendetta) compareManifest() error {
+	if v.Manifest == "" {
+		return nil
+	}
+
+	listed, err := ReadPackageList(v.Manifest)
+	if err != nil {
+		return err
+	}
+
+	want := make(map[string]bool)
+	for _, pkg := range listed {
+		want[pkg] = true
+	}
+
+	have := make(map[string]bool)
+	for _, sm := range v.submodules {
+		if !sm.used || !isSubpath(sm.dir, "vendor") {
+			continue
+		}
+
+		pkg := pathToPackage(sm.dir[len("vendor")+1:])
+		have[pkg] = true
+		if !want[pkg] {
+			fmt.Fprintf(v.Stdout, "Warning: %s is a dependency, but isn't listed in %s\n",
+				pkg, v.Manifest)
+			v.notInManifest = append(v.notInManifest, pkg)
+		}
+	}
+
+	for _, pkg := range listed {
+		if !have[pkg] {
+			fmt.Fprintf(v.Stdout, "Warning: %s is listed in %s, but is no longer a dependency\n",
+				pkg, v.Manifest)
+			v.notImported = append(v.notImported, pkg)
+		}
+	}
+
+	sort.Strings(v.notInManifest)
+	sort.Strings(v.notImported)
+
+	if v.Check && len(v.notInManifest)+len(v.notImported) > 0 {
+		return fmt.Errorf("The dependencies differ from those listed in %s (see the warnings above)",
+			v.Manifest)
+	}
+
+	return nil
+}
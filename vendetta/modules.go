@@ -0,0 +1,130 @@
+package vendetta
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Write vendor/modules.txt, so that the go tool accepts the vendor
+// directory when building in module mode.  Each submodule under
+// vendor/ is treated as a module, and the packages listed for it are
+// those that we found to be imported.
+func (v *vendetta) writeModulesTxt() error {
+	modPkgs := make(map[string][]string)
+	for dir := range v.dirPackages {
+		if !isSubpath(dir, "vendor") {
+			continue
+		}
+
+		// Packages under nested vendor directories have import
+		// paths that modules.txt can't express.
+		pkg := pathToPackage(dir[len("vendor")+1:])
+		if isNestedVendor(pkg) {
+			continue
+		}
+
+		if sm, ok := v.pathInSubmodule(dir); ok && sm.used {
+			modPkgs[sm.dir] = append(modPkgs[sm.dir], pkg)
+		}
+	}
+
+	smDirs := make([]string, 0, len(modPkgs))
+	for dir := range modPkgs {
+		smDirs = append(smDirs, dir)
+	}
+
+	sort.Strings(smDirs)
+
+	path := v.realDir(filepath.Join("vendor", "modules.txt"))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, smDir := range smDirs {
+		// The go tool checks that the modules marked as
+		// explicit are exactly those required by go.mod, at the
+		// versions it gives.
+		mod := pathToPackage(smDir[len("vendor")+1:])
+		if version, required := v.requires[mod]; required {
+			fmt.Fprintf(w, "# %s %s\n## explicit\n", mod, version)
+		} else {
+			version, err := v.pseudoVersion(smDir, mod)
+			if err != nil {
+				f.Close()
+				return err
+			}
+
+			fmt.Fprintf(w, "# %s %s\n", mod, version)
+		}
+
+		pkgs := modPkgs[smDir]
+		sort.Strings(pkgs)
+		for _, pkg := range pkgs {
+			fmt.Fprintln(w, pkg)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	fmt.Fprintf(v.Stderr, "Wrote %s\n", path)
+	return f.Close()
+}
+
+func isNestedVendor(pkg string) bool {
+	return pkg == "vendor" || strings.HasPrefix(pkg, "vendor/") ||
+		strings.HasSuffix(pkg, "/vendor") ||
+		strings.Contains(pkg, "/vendor/")
+}
+
+var majorVersionRE = regexp.MustCompile(`/v([2-9]|[1-9][0-9]+)$`)
+
+// Produce a pseudo-version (as used by the go tool for untagged
+// commits) for the commit checked out in the submodule at dir.
+func (v *vendetta) pseudoVersion(dir, mod string) (string, error) {
+	commit, err := v.popen("git", "-C", dir, "log", "-1",
+		"--format=%H %ct")
+	if err != nil {
+		return "", err
+	}
+
+	defer commit.close()
+
+	var fields []string
+	if commit.Scan() {
+		fields = splitWS(commit.Text())
+	}
+
+	if err := commit.close(); err != nil {
+		return "", err
+	}
+
+	if len(fields) != 2 || len(fields[0]) < 12 {
+		return "", fmt.Errorf("could not parse 'git log' output for %s", dir)
+	}
+
+	secs, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("could not parse 'git log' output for %s", dir)
+	}
+
+	major := "v0"
+	if m := majorVersionRE.FindStringSubmatch(mod); m != nil {
+		major = "v" + m[1]
+	}
+
+	return fmt.Sprintf("%s.0.0-%s-%s", major,
+		time.Unix(secs, 0).UTC().Format("20060102150405"),
+		fields[0][:12]), nil
+}
@@ -0,0 +1,45 @@
+package vendetta
+
+import (
+	"go/build"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// Only modules required by go.mod are marked as explicit in
+// modules.txt, with the versions it requires.
+func TestWriteModulesTxtExplicit(t *testing.T) {
+	gitTestEnv(t)
+	v := testVendetta(t, nil)
+	v.dirPackages = make(map[string]*build.Package)
+	v.requires = map[string]string{"example.com/a": "v1.2.0"}
+	for _, mod := range []string{"a", "b"} {
+		dir := filepath.Join("vendor", "example.com", mod)
+		makeGitRepo(t, v.realDir(dir), map[string]string{
+			mod + ".go": "package " + mod + "\n",
+		})
+		v.addSubmodule(submodule{dir: dir, used: true})
+		v.dirPackages[dir] = &build.Package{}
+	}
+
+	if err := v.writeModulesTxt(); err != nil {
+		t.Fatal(err)
+	}
+
+	txt, err := ioutil.ReadFile(v.realDir(filepath.Join("vendor", "modules.txt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := regexp.MustCompile(`^# example\.com/a v1\.2\.0
+## explicit
+example\.com/a
+# example\.com/b v0\.0\.0-\d{14}-[0-9a-f]{12}
+example\.com/b
+$`)
+	if !want.Match(txt) {
+		t.Errorf("unexpected modules.txt:\n%s", txt)
+	}
+}
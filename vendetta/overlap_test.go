@@ -0,0 +1,89 @@
+package vendetta
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Set up a project with example.com/a vendored as a submodule, and a
+// rule that puts the root of example.com/a/b/... inside it, then
+// vendor the given import.
+func runOverlap(t *testing.T, aFiles map[string]string, imp string) (string, error) {
+	gitTestEnv(t)
+	tmp := t.TempDir()
+	url := func(name string) string {
+		return filepath.ToSlash(filepath.Join(tmp, name))
+	}
+
+	makeGitRepo(t, filepath.Join(tmp, "a"), aFiles)
+	makeGitRepo(t, filepath.Join(tmp, "ab"), map[string]string{
+		"c/c.go": "package c\n",
+	})
+	makeGitRepo(t, filepath.Join(tmp, "d"), map[string]string{
+		"d.go": "package d\n",
+	})
+
+	proj := filepath.Join(tmp, "proj")
+	makeGitRepo(t, proj, map[string]string{
+		"main.go": "package main\n\nimport _ \"example.com/a\"\n\nfunc main() {}\n",
+		configFile: `{"rules": [
+			{"match": "^example\\.com/a/b$", "url": "` + url("ab") + `", "rootSegments": 3},
+			{"match": "^example\\.com/a$", "url": "` + url("a") + `", "rootSegments": 2},
+			{"match": "^example\\.com/d$", "url": "` + url("d") + `", "rootSegments": 2}]}`,
+	})
+
+	var out bytes.Buffer
+	opts := Options{
+		Root:        proj,
+		ProjectName: "example.com/proj",
+		Stdout:      &out,
+		Stderr:      &out,
+	}
+	if _, err := Run(opts); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+
+	writeFiles(t, proj, map[string]string{
+		"main.go": "package main\n\nimport _ \"" + imp + "\"\n\nfunc main() {}\n",
+	})
+
+	_, err := Run(opts)
+	gitmodules, rerr := ioutil.ReadFile(filepath.Join(proj, ".gitmodules"))
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+
+	if strings.Contains(string(gitmodules), "vendor/example.com/a/b") {
+		t.Errorf("a nested submodule was added:\n%s", gitmodules)
+	}
+
+	return string(gitmodules), err
+}
+
+func TestOverlapResolvedFromParent(t *testing.T) {
+	gitmodules, err := runOverlap(t, map[string]string{
+		"a.go":     "package a\n",
+		"b/c/c.go": "package c\n\nimport _ \"example.com/d\"\n",
+	}, "example.com/a/b/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The package was scanned in the parent submodule, so its
+	// own imports got vendored.
+	if !strings.Contains(gitmodules, "path = vendor/example.com/d") {
+		t.Errorf("the imports of example.com/a/b/c weren't vendored:\n%s", gitmodules)
+	}
+}
+
+func TestOverlapMissingFromParent(t *testing.T) {
+	_, err := runOverlap(t, map[string]string{
+		"a.go": "package a\n",
+	}, "example.com/a/b/c")
+	if err == nil || !strings.Contains(err.Error(), "should be provided by the submodule vendor/example.com/a") {
+		t.Fatalf("expected an error about the parent submodule, got %v", err)
+	}
+}
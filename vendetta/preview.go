@@ -0,0 +1,121 @@
+package vendetta
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// With -preview-gitmodules, show how .gitmodules would change, as a
+// unified diff against the current file.  The new contents are made
+// by applying the changes to a copy of the file with 'git config', as
+// 'git submodule add' would, so that the formatting matches.
+func (v *vendetta) previewGitmodules() error {
+	tmp, err := ioutil.TempDir("", "vendetta")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(tmp)
+
+	old, err := ioutil.ReadFile(v.realDir(filepath.Join(v.depsRepo(),
+		".gitmodules")))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, side := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(tmp, side), 0777); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(tmp, side, ".gitmodules"),
+			old, 0666); err != nil {
+			return err
+		}
+	}
+
+	gitmodules, err := v.readGitmodules()
+	if err != nil {
+		return err
+	}
+
+	newFile := filepath.Join(tmp, "b", ".gitmodules")
+	config := func(args ...string) error {
+		return v.git(append([]string{"config", "-f", newFile}, args...)...)
+	}
+
+	for _, sm := range v.submodules {
+		if sm.subtree || !isSubpath(sm.dir, "vendor") {
+			continue
+		}
+
+		switch {
+		case sm.pending:
+			if err := v.previewSubmodule(sm, config); err != nil {
+				return err
+			}
+		case !sm.used && v.Prune:
+			if gm := gitmodules[sm.dir]; gm != nil {
+				if err := config("--remove-section",
+					"submodule."+gm.name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	cmd := v.command("git", "--no-pager", "diff", "--no-index",
+		"--no-prefix", "--", filepath.Join("a", ".gitmodules"),
+		filepath.Join("b", ".gitmodules"))
+	cmd.Dir = tmp
+	cmd.Stdout = v.Stdout
+	cmd.Stderr = v.Stderr
+	v.traceStart(cmd)
+	err = cmd.Run()
+	v.traceDone(cmd, err)
+	if err == nil {
+		fmt.Fprintln(v.Stdout, "No changes to .gitmodules")
+		return nil
+	}
+
+	// git diff exits with status 1 if there are differences
+	if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+		return nil
+	}
+
+	return commandFailed(cmd.Args, "", err)
+}
+
+// Add the .gitmodules settings for a pending submodule, using config.
+func (v *vendetta) previewSubmodule(sm submodule, config func(args ...string) error) error {
+	name, err := v.newSubmoduleName(sm.dir,
+		pathToPackage(sm.dir[len("vendor")+1:]))
+	if err != nil {
+		return err
+	}
+
+	url := sm.url
+	if v.RelativePaths {
+		if url, err = v.relativeURL(url); err != nil {
+			return err
+		}
+	}
+
+	prefix := "submodule." + name + "."
+	if err := config(prefix+"path", v.depsPath(sm.dir)); err != nil {
+		return err
+	}
+
+	if err := config(prefix+"url", url); err != nil {
+		return err
+	}
+
+	if sm.branch != "" {
+		return config(prefix+"branch", sm.branch)
+	}
+
+	return nil
+}
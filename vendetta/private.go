@@ -0,0 +1,70 @@
+package vendetta
+
+import (
+	"path"
+	"strings"
+)
+
+// The go environment variables listing patterns for private import
+// paths, which should not be looked up through public services.
+var privateEnvVars = []string{"GOPRIVATE", "GONOSUMDB"}
+
+// Get the private import path patterns, with goEnv.
+func readPrivatePatterns() []string {
+	var patterns []string
+	for _, name := range privateEnvVars {
+		value := goEnv(name)
+		for _, pattern := range strings.Split(value, ",") {
+			pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+			if pattern != "" {
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+
+	return patterns
+}
+
+// Is the package private according to GOPRIVATE or GONOSUMDB?  The
+// patterns are read the first time they are needed, so that runs
+// that don't look anything up don't need the go tool.
+func (v *vendetta) private(pkg string) bool {
+	v.privateOnce.Do(func() {
+		v.privatePatterns = readPrivatePatterns()
+	})
+
+	for _, pattern := range v.privatePatterns {
+		if matchPrefixPattern(pattern, pkg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Does a glob pattern match a prefix of an import path, with the
+// same semantics as GOPRIVATE?  The pattern is matched with
+// path.Match against the leading elements of the import path, as
+// many as the pattern has, so "*.corp.example" matches
+// "git.corp.example/x/y".
+func matchPrefixPattern(pattern, pkg string) bool {
+	n := strings.Count(pattern, "/")
+	prefix := pkg
+	for i := 0; i < len(pkg); i++ {
+		if pkg[i] == '/' {
+			if n == 0 {
+				prefix = pkg[:i]
+				break
+			}
+
+			n--
+		}
+	}
+
+	if n > 0 {
+		return false
+	}
+
+	matched, err := path.Match(pattern, prefix)
+	return err == nil && matched
+}
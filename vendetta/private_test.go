@@ -0,0 +1,30 @@
+package vendetta
+
+import "testing"
+
+// GOPRIVATE is taken from the environment, and go env is only asked
+// about GONOSUMDB, which is unset.
+func TestPrivatePatterns(t *testing.T) {
+	fakeGoEnv(t, "nosumdb.example")
+	t.Setenv("GOPRIVATE", "*.corp.example, git.example/team/")
+	unsetenv(t, "GONOSUMDB")
+
+	v := &vendetta{}
+	if v.privatePatterns != nil {
+		t.Fatal("private patterns read too early")
+	}
+
+	for pkg, want := range map[string]bool{
+		"git.corp.example/x/y":    true,
+		"corp.example/x":          false,
+		"git.example/team/repo":   true,
+		"git.example/teams/repo":  false,
+		"nosumdb.example/a/b":     true,
+		"github.com/foo/bar":      false,
+		"sub.nosumdb.example/a/b": false,
+	} {
+		if got := v.private(pkg); got != want {
+			t.Errorf("private(%q) = %v, want %v", pkg, got, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package vendetta
+
+import (
+	"testing"
+)
+
+func TestCheckProjectName(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		ok   bool
+	}{
+		{"", false},
+		{"/", false},
+		{"github.com/", false},
+		{"github.com", false},
+		{"example.com", false},
+		{"gopkg.in", false},
+		{"myproject", true},
+		{".", false},
+		{"..", false},
+		{"go4.org", true},
+		{"github.com/foo", false},
+		{"github.com/foo/bar", true},
+		{"github.com/foo/bar/sub", true},
+		{"example.com/proj", true},
+		{"example.com/../proj", false},
+	} {
+		err := checkProjectName(c.name)
+		if (err == nil) != c.ok {
+			t.Errorf("checkProjectName(%q) = %v, want ok=%v",
+				c.name, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package vendetta
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// With -reference-cache, find a local clone of the repo for a new
+// submodule, so that 'git clone' can take objects from it rather
+// than fetching them all over the network.  The cache directory can
+// hold clones (bare or not) at paths given by their repo roots, e.g.
+// github.com/user/repo or github.com/user/repo.git.  It can also be
+// the go tool's module cache ($GOPATH/pkg/mod), which keeps bare
+// repos under cache/vcs, named by a hash of their URLs.
+func (v *vendetta) findReference(loc repoLocation) string {
+	if v.ReferenceCache == "" {
+		return ""
+	}
+
+	root := filepath.FromSlash(loc.root)
+	vcsHash := fmt.Sprintf("%x", sha256.Sum256([]byte("git-"+loc.url)))
+	for _, path := range []string{
+		filepath.Join(v.ReferenceCache, root),
+		filepath.Join(v.ReferenceCache, root+".git"),
+		filepath.Join(v.ReferenceCache, "cache", "vcs", vcsHash),
+	} {
+		if isGitRepo(path) {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// Does path look like a git repo, either a working tree or a bare
+// repo?
+func isGitRepo(path string) bool {
+	for _, name := range []string{".git", "objects"} {
+		if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
@@ -29,7 +29,7 @@
 // (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
 // OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
-package main
+package vendetta
 
 import (
 	"crypto/tls"
@@ -207,10 +207,16 @@ var errNoMatch = errors.New("no import match")
 // matchGoImport returns the metaImport from imports matching importPath.
 // An error is returned if there are multiple matches.
 // errNoMatch is returned if none match.
+//
+// The prefix must match whole elements of importPath, so that a
+// vanity root such as example.com/group/thing (whose repo root
+// lies several elements below the host) doesn't also claim
+// example.com/group/thingy.  The repo root is then the prefix
+// itself, however many elements it has.
 func matchGoImport(imports []metaImport, importPath string) (_ metaImport, err error) {
 	match := -1
 	for i, im := range imports {
-		if !strings.HasPrefix(importPath, im.Prefix) {
+		if !isSubpackage(importPath, im.Prefix) {
 			continue
 		}
 		if match != -1 {
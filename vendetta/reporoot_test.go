@@ -0,0 +1,69 @@
+package vendetta
+
+import (
+	"strings"
+	"testing"
+)
+
+// A go-import prefix four elements long matches its own subpackages,
+// but not import paths that merely extend its last element.
+func TestMatchGoImportDeepPrefix(t *testing.T) {
+	imports, err := parseMetaGoImports(strings.NewReader(`<html><head>
+<meta name="go-import" content="a.b/c/d/e git https://git.a.b/c/d/e.git">
+<meta name="go-import" content="a.b/c/d/ef git https://git.a.b/c/d/ef.git">
+</head></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		path, prefix string
+	}{
+		{"a.b/c/d/e", "a.b/c/d/e"},
+		{"a.b/c/d/e/f/g", "a.b/c/d/e"},
+		{"a.b/c/d/ef", "a.b/c/d/ef"},
+		{"a.b/c/d/ef/g", "a.b/c/d/ef"},
+		{"a.b/c/d/eff", ""},
+		{"a.b/c/d", ""},
+		{"a.b/c/de", ""},
+	} {
+		im, err := matchGoImport(imports, c.path)
+		if c.prefix == "" {
+			if err != errNoMatch {
+				t.Errorf("matchGoImport(%q) = %v, %v, want no match",
+					c.path, im, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("matchGoImport(%q): %v", c.path, err)
+		} else if im.Prefix != c.prefix {
+			t.Errorf("matchGoImport(%q) matched %q, want %q",
+				c.path, im.Prefix, c.prefix)
+		}
+	}
+}
+
+func TestMatchGoImportShortPrefix(t *testing.T) {
+	imports := []metaImport{
+		{Prefix: "a.b/c/d", VCS: "git", RepoRoot: "https://git.a.b/c/d"},
+	}
+
+	if _, err := matchGoImport(imports, "a.b/c/de"); err != errNoMatch {
+		t.Errorf("a.b/c/d matched a.b/c/de (%v)", err)
+	}
+
+	im, err := matchGoImport(imports, "a.b/c/d/e")
+	if err != nil || im.Prefix != "a.b/c/d" {
+		t.Errorf("matchGoImport(a.b/c/d/e) = %v, %v", im, err)
+	}
+
+	// Overlapping prefixes are ambiguous
+	imports = append(imports, metaImport{Prefix: "a.b/c/d/e",
+		VCS: "git", RepoRoot: "https://git.a.b/c/d/e"})
+	if _, err := matchGoImport(imports, "a.b/c/d/e/f"); err == nil || err == errNoMatch {
+		t.Errorf("overlapping prefixes gave %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package vendetta
+
+import (
+	"fmt"
+	"sort"
+)
+
+// With -ignore-existing, the existing submodules are ignored, so
+// every dependency is resolved from scratch, and nothing is changed.
+// Then compare the repo URLs that were worked out with those in
+// .gitmodules, to catch entries that have diverged from what vendetta
+// would produce.
+func (v *vendetta) compareResolvedURLs() error {
+	gitmodules, err := v.readGitmodules()
+	if err != nil {
+		return err
+	}
+
+	resolved := make(map[string]struct{})
+	for _, sm := range v.submodules {
+		if !sm.pending || !isSubpath(sm.dir, "vendor") {
+			continue
+		}
+
+		resolved[sm.dir] = struct{}{}
+		gm := gitmodules[sm.dir]
+		switch {
+		case gm == nil:
+			fmt.Fprintf(v.Stdout, "%s: resolves to %s, but is not in .gitmodules\n",
+				sm.dir, sm.url)
+		case normalizeRepoURL(gm.url) != normalizeRepoURL(sm.url):
+			fmt.Fprintf(v.Stdout, "%s: resolves to %s, but .gitmodules has %s\n",
+				sm.dir, sm.url, gm.url)
+		default:
+			fmt.Fprintf(v.Stderr, "%s: resolves to %s, as in .gitmodules\n",
+				sm.dir, sm.url)
+		}
+	}
+
+	var unresolved []string
+	for dir := range gitmodules {
+		if _, found := resolved[dir]; !found && isSubpath(dir, "vendor") {
+			unresolved = append(unresolved, dir)
+		}
+	}
+
+	sort.Strings(unresolved)
+	for _, dir := range unresolved {
+		fmt.Fprintf(v.Stdout, "%s: in .gitmodules, but no dependency resolves to it\n",
+			dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package vendetta
+
+import (
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// With -rewrite-imports, imports in vendored packages that refer to
+// packages in their own nested vendor directories (e.g.
+// github.com/x/y/vendor/github.com/z/w) get rewritten to refer to the
+// top-level vendored copies (github.com/z/w), so that only one copy
+// of each dependency gets built.  Only vendored files are touched,
+// and only the import paths in them are changed.
+func (v *vendetta) rewriteImports() error {
+	var dirs []string
+	pkgs := make(map[string]*build.Package)
+	v.mu.Lock()
+	for dir, pkg := range v.dirPackages {
+		if isSubpath(dir, "vendor") {
+			dirs = append(dirs, dir)
+			pkgs[dir] = pkg
+		}
+	}
+	v.mu.Unlock()
+
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		pkg := pkgs[dir]
+		var files []string
+		for _, list := range [][]string{pkg.GoFiles, pkg.CgoFiles,
+			pkg.IgnoredGoFiles, pkg.TestGoFiles, pkg.XTestGoFiles} {
+			files = append(files, list...)
+		}
+
+		for _, file := range files {
+			if err := v.rewriteFileImports(filepath.Join(dir, file)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (v *vendetta) rewriteFileImports(file string) error {
+	path := v.realDir(file)
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.ImportsOnly)
+	if err != nil {
+		return err
+	}
+
+	// Replace the import path literals in the source, working
+	// backwards so that the offsets remain valid.
+	changed := false
+	for i := len(f.Imports) - 1; i >= 0; i-- {
+		lit := f.Imports[i].Path
+		imp, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			continue
+		}
+
+		slash := strings.LastIndex(imp, "/vendor/")
+		if slash < 0 {
+			continue
+		}
+
+		newImp := imp[slash+len("/vendor/"):]
+		if _, err := os.Stat(v.realDir(filepath.Join("vendor", packageToPath(newImp)))); err != nil {
+			fmt.Fprintf(v.Stdout, "Warning: not rewriting import of %s in %s, as %s is not vendored at the top level\n",
+				imp, file, newImp)
+			continue
+		}
+
+		start := fset.Position(lit.Pos()).Offset
+		end := fset.Position(lit.End()).Offset
+		src = append(src[:start:start],
+			append([]byte(strconv.Quote(newImp)), src[end:]...)...)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(v.Stderr, "Rewriting imports in %s\n", file)
+	return ioutil.WriteFile(path, src, fi.Mode())
+}
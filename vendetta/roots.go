@@ -0,0 +1,176 @@
+package vendetta
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Scan the packages of the extra roots given by Options.ExtraRoots,
+// and of the local directories that go.mod replaces modules with.
+// Each is the directory of another project, optionally followed by
+// =name to give its project name.  The dependencies of the extra
+// roots get vendored into the main project, so that they all share
+// one vendor directory.
+func (v *vendetta) scanExtraRoots() ([]rootPackage, error) {
+	var pkgs []rootPackage
+	args := append(append([]string(nil), v.ExtraRoots...),
+		v.replaceRoots...)
+	for _, arg := range args {
+		path, name := arg, ""
+		if eq := strings.LastIndex(arg, "="); eq >= 0 {
+			path, name = arg[:eq], arg[eq+1:]
+		}
+
+		dir, err := v.extraRootDir(path)
+		if err != nil {
+			return nil, err
+		}
+
+		rootPkgs, err := v.scanProject(dir, true)
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "" {
+			name = v.extraRootName(dir, rootPkgs)
+		}
+
+		if name == "" {
+			if !mainOnly(rootPkgs) {
+				return nil, &ProjectInferenceError{Dir: path,
+					Hint: "give it as " + path + "=<name>"}
+			}
+		} else {
+			if err := checkProjectName(name); err != nil {
+				return nil, err
+			}
+
+			// Add the extra root to the end of the chain of
+			// goPaths, so that packages can be found there
+			// from anywhere.
+			gp := &goPath{dir: dir,
+				prefixes: map[string]struct{}{name: {}}}
+			last := &v.goPath
+			if len(v.extraRoots) > 0 {
+				last = v.extraRoots[len(v.extraRoots)-1]
+			}
+
+			last.next = gp
+			v.extraRoots = append(v.extraRoots, gp)
+		}
+
+		pkgs = append(pkgs, rootPkgs...)
+	}
+
+	return pkgs, nil
+}
+
+// Find the directory of an extra root, relative to rootDir.
+func (v *vendetta) extraRootDir(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	fi, err := os.Stat(abs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", usageErrorf("The directory %s does not exist", abs)
+		}
+
+		return "", err
+	}
+
+	if !fi.IsDir() {
+		return "", usageErrorf("%s is not a directory", abs)
+	}
+
+	// rootDir may have come from git, which resolves symlinks
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return "", err
+	}
+
+	dir, err := filepath.Rel(v.rootDir, abs)
+	if err != nil {
+		return "", err
+	}
+
+	if dir == "." {
+		return "", usageErrorf("%s is the project directory, so can't be an extra root", abs)
+	}
+
+	return dir, nil
+}
+
+// Infer the project name for an extra root at dir from the import
+// comments of its packages.
+func (v *vendetta) extraRootName(dir string, pkgs []rootPackage) string {
+	for _, pkg := range pkgs {
+		if pkg.ImportComment == "" {
+			continue
+		}
+
+		rel, err := filepath.Rel(dir, pkg.dir)
+		if err != nil {
+			continue
+		}
+
+		if rel == "." {
+			rel = ""
+		}
+
+		if proj, ok := projectFromImportComment(pkg.ImportComment, rel); ok {
+			fmt.Fprintln(v.Stdout, "Inferred root package name", proj,
+				"for", dir, "from import comment in", pkg.dir)
+			return proj
+		}
+	}
+
+	return ""
+}
+
+// Find the project name (of the main project or an extra root) that
+// pkg falls under, or overlaps with.
+func (v *vendetta) overlappingProject(pkg string) string {
+	check := func(prefixes map[string]struct{}) string {
+		for prefix := range prefixes {
+			if isSubpackage(pkg, prefix) || isSubpackage(prefix, pkg) {
+				return prefix
+			}
+		}
+
+		return ""
+	}
+
+	if prefix := check(v.prefixes); prefix != "" {
+		return prefix
+	}
+
+	for _, gp := range v.extraRoots {
+		if prefix := check(gp.prefixes); prefix != "" {
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+// Check that no submodule under vendor/ provides packages that could
+// also be in a project, which would make imports ambiguous.  This is
+// almost always due to a wrong project name.
+func (v *vendetta) checkProjectOverlap() error {
+	for _, sm := range v.submodules {
+		if !isSubpath(sm.dir, "vendor") {
+			continue
+		}
+
+		pkg := pathToPackage(sm.dir[len("vendor")+1:])
+		if prefix := v.overlappingProject(pkg); prefix != "" {
+			return fmt.Errorf("The submodule %s provides %s, which overlaps with the project name %s, so imports of it would be ambiguous.  Check the project name, or remove the submodule.", sm.dir, pkg, prefix)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package vendetta
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The values of Options.StaleDirs
+const (
+	StaleFail    = "fail"
+	StaleReplace = "replace"
+	StaleSkip    = "skip"
+)
+
+// errStaleSkipped marks a new submodule that was not added because
+// its directory was already there, with -stale-dirs=skip.
+var errStaleSkipped = errors.New("stale directory skipped")
+
+// Did a git command fail because the directory for a new submodule
+// already exists, on disk or in the index?  This happens when an
+// earlier run was interrupted, leaving a partial clone or a gitlink
+// without a .gitmodules entry.
+func alreadyExists(err error) bool {
+	var ge *GitCommandError
+	return errors.As(err, &ge) && strings.Contains(ge.Stderr, "already exists")
+}
+
+// Decide what to do about the stale directory for a new submodule
+// that git refused to create, according to -stale-dirs.  nil means
+// that the caller should clear it away and try again.  With skip,
+// errStaleSkipped is returned.
+func (v *vendetta) staleDir(c pendingClone, err error) error {
+	switch v.StaleDirs {
+	case StaleReplace:
+		fmt.Fprintf(v.Stdout, "Warning: %s already exists but isn't a submodule, so replacing it\n",
+			c.dir)
+		return nil
+	case StaleSkip:
+		fmt.Fprintf(v.Stdout, "Warning: %s already exists but isn't a submodule, so not adding %s there\n",
+			c.dir, c.loc.url)
+		return errStaleSkipped
+	default:
+		return fmt.Errorf("%s already exists but isn't a submodule, perhaps left by an interrupted run; use -stale-dirs=replace to replace it (%v)",
+			c.dir, err)
+	}
+}
+
+// Remove a stale entry for the directory of a new submodule from the
+// index, along with any repo under .git/modules for the submodule
+// name, so that 'git submodule add' can be tried again.
+func (v *vendetta) unstageStaleDir(dir, name string) error {
+	if err := v.depsGit("rm", "-q", "-r", "-f", "--cached", "--ignore-unmatch",
+		"--", v.depsPath(dir)); err != nil {
+		return err
+	}
+
+	return v.removeModuleGitDir(name)
+}
+
+// Forget a pending submodule that won't be added after all.
+func (v *vendetta) dropSubmodule(dir string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for i, sm := range v.submodules {
+		if sm.dir == dir {
+			v.submodules = append(v.submodules[:i],
+				v.submodules[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package vendetta
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSubmoduleStatus(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	for _, c := range []struct {
+		line, path string
+		ok         bool
+	}{
+		{" " + sha + " vendor/github.com/foo/bar (v1.0.0)", "vendor/github.com/foo/bar", true},
+		{" " + sha + " vendor/github.com/foo/bar", "vendor/github.com/foo/bar", true},
+		{"-" + sha + " vendor/github.com/foo/bar", "vendor/github.com/foo/bar", true},
+		{"+" + sha + " vendor/github.com/foo/bar (heads/master)", "vendor/github.com/foo/bar", true},
+		{"U" + sha + " vendor/github.com/foo/bar", "vendor/github.com/foo/bar", true},
+		{" " + sha + " vendor/with space/dir (v1)", "vendor/with space/dir", true},
+		{" " + sha + " vendor/paren (x)/dir", "vendor/paren (x)/dir", true},
+		{"", "", false},
+		{" ", "", false},
+		{"-" + sha, "", false},
+		{"-" + sha + " ", "", false},
+		{"X" + sha + " vendor/foo", "", false},
+		{"  vendor/foo", "", false},
+	} {
+		path, ok := parseSubmoduleStatus(c.line)
+		if ok != c.ok || path != filepath.FromSlash(c.path) {
+			t.Errorf("parseSubmoduleStatus(%q) = %q, %v, want %q, %v",
+				c.line, path, ok, c.path, c.ok)
+		}
+	}
+}
+
+// Lookups respect path element boundaries, so vendor/x/bar doesn't
+// contain vendor/x/barbaz, whatever order the submodules sort in.
+func TestFindSubmoduleBoundary(t *testing.T) {
+	v := &vendetta{}
+	for _, dir := range []string{"vendor/x/bar", "vendor/x/bar-x", "vendor/x/barbaz", "vendor/x/bar/nested"} {
+		v.addSubmodule(submodule{dir: filepath.FromSlash(dir)})
+	}
+
+	for _, c := range []struct {
+		path, want string
+	}{
+		{"vendor/x/bar", "vendor/x/bar"},
+		{"vendor/x/bar/y", "vendor/x/bar"},
+		{"vendor/x/barbaz", "vendor/x/barbaz"},
+		{"vendor/x/barbaz/y", "vendor/x/barbaz"},
+		{"vendor/x/bar-x/y", "vendor/x/bar-x"},
+		{"vendor/x/bar/nested/y", "vendor/x/bar/nested"},
+		{"vendor/x/ba", ""},
+		{"vendor/x/barb", ""},
+		{"vendor/x", ""},
+	} {
+		got := ""
+		if sm := v.findSubmodule(filepath.FromSlash(c.path)); sm != nil {
+			got = sm.dir
+		}
+
+		if got != filepath.FromSlash(c.want) {
+			t.Errorf("findSubmodule(%q) = %q, want %q", c.path, got, c.want)
+		}
+	}
+}
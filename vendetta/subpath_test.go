@@ -0,0 +1,37 @@
+package vendetta
+
+import (
+	"testing"
+)
+
+func TestIsSubpathSep(t *testing.T) {
+	for _, sep := range []byte{'/', '\\'} {
+		s := string(sep)
+		for _, c := range []struct {
+			path, dir string
+			want      bool
+		}{
+			{"vendor" + s + "x" + s + "bar", "vendor", true},
+			{"vendor" + s + "x" + s + "bar", "vendor" + s + "x" + s + "bar", true},
+			{"vendor" + s + "x" + s + "barbaz", "vendor" + s + "x" + s + "bar", false},
+			{"vendor", "vendor" + s + "x", false},
+			{"vendors" + s + "x", "vendor", false},
+			{"vendor" + s + "x", "", true},
+			{"", "", true},
+		} {
+			if got := isSubpathSep(c.path, c.dir, sep); got != c.want {
+				t.Errorf("isSubpathSep(%q, %q, %q) = %v, want %v",
+					c.path, c.dir, sep, got, c.want)
+			}
+		}
+	}
+
+	// The other separator is just part of an element
+	if isSubpathSep(`vendor\x`, "vendor", '/') {
+		t.Error(`vendor\x is within vendor with '/' separators`)
+	}
+
+	if isSubpathSep("vendor/x", "vendor", '\\') {
+		t.Error(`vendor/x is within vendor with '\' separators`)
+	}
+}
@@ -0,0 +1,83 @@
+package vendetta
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The values of Options.Mode
+const (
+	ModeSubmodule = "submodule"
+	ModeSubtree   = "subtree"
+)
+
+func (v *vendetta) subtreeMode() bool {
+	return v.Mode == ModeSubtree
+}
+
+// Add a repo at dir with "git subtree add", rather than as a
+// submodule.
+func (v *vendetta) gitSubtreeAdd(loc repoLocation, dir string) error {
+	ref := loc.tag
+	if ref == "" {
+		ref = loc.branch
+	}
+
+	if ref == "" {
+		var err error
+		if ref, err = v.remoteHeadBranch("", loc.url); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(v.Stderr, "Adding %s (%s) as a subtree at %s\n",
+		loc.url, ref, dir)
+	if err := v.git("subtree", "add", "--prefix", filepath.ToSlash(dir),
+		loc.url, ref, "--squash"); err != nil {
+		return err
+	}
+
+	v.addSubmodule(submodule{dir: dir, used: true, url: loc.url,
+		subtree: true})
+	return nil
+}
+
+// Find the directories of subtrees previously added with "git
+// subtree add --squash".  Subtrees aren't recorded in .gitmodules,
+// but the commits that add them contain a git-subtree-dir line.
+func (v *vendetta) querySubtrees() ([]string, error) {
+	log, err := v.popen("git", "log", "--grep=^git-subtree-dir:",
+		"--format=%B")
+	if err != nil {
+		return nil, err
+	}
+
+	defer log.close()
+
+	seen := make(map[string]bool)
+	var dirs []string
+	for log.Scan() {
+		line := strings.TrimSpace(log.Text())
+		if !strings.HasPrefix(line, "git-subtree-dir:") {
+			continue
+		}
+
+		dir := filepath.FromSlash(strings.TrimSpace(
+			line[len("git-subtree-dir:"):]))
+		dir = strings.TrimSuffix(dir, string(os.PathSeparator))
+		if seen[dir] {
+			continue
+		}
+
+		seen[dir] = true
+
+		// The subtree may since have been removed
+		if fi, err := os.Stat(v.realDir(dir)); err == nil && fi.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs, log.close()
+}
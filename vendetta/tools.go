@@ -0,0 +1,113 @@
+package vendetta
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The build tags conventionally used for files that import tools
+// (such as code generators) which the project depends on, but which
+// are not part of its build.
+var toolsTags = []string{"tools", "ignore"}
+
+// With -tools, find the imports of the files in dir that are only
+// included with toolsTags.  We don't load these files as a package,
+// because files tagged with ignore are often standalone programs
+// that belong to a different package than the other files in the
+// same directory.
+func (v *vendetta) toolImports(dir string) (name string, imports, testImports []string, err error) {
+	ctx := v.buildContext
+	ctx.BuildTags = append(append([]string(nil), ctx.BuildTags...),
+		toolsTags...)
+
+	return v.excludedFileImports(dir, false, func(file string) (bool, error) {
+		return ctx.MatchFile(v.realDir(dir), file)
+	})
+}
+
+// With -include-ignored, find the imports of all the files in dir
+// that are excluded by build constraints (the IgnoredGoFiles of the
+// package), e.g. generated files that are only built with a certain
+// tag.
+func (v *vendetta) ignoredImports(dir string) (name string, imports, testImports []string, err error) {
+	return v.excludedFileImports(dir, !v.NoTests,
+		func(string) (bool, error) { return true, nil })
+}
+
+// Find the imports of the Go files in dir that are excluded by the
+// build context, but accepted by match.  Test files are only
+// considered if tests is set, and their imports are returned
+// separately, as testImports.  The package name returned comes from
+// the non-test files.  A file that can't be parsed is treated like a
+// package that can't be loaded, so it only gets a warning unless
+// -strict is given.
+func (v *vendetta) excludedFileImports(dir string, tests bool, match func(file string) (bool, error)) (name string, imports, testImports []string, err error) {
+	fis, err := ioutil.ReadDir(v.realDir(dir))
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	for _, fi := range fis {
+		file := fi.Name()
+		isTest := strings.HasSuffix(file, "_test.go")
+		if !fi.Mode().IsRegular() || !strings.HasSuffix(file, ".go") ||
+			isTest && !tests {
+			continue
+		}
+
+		matched, err := match(file)
+		if err != nil {
+			if err := v.loadFailed(dir, true, err); err != nil {
+				return "", nil, nil, err
+			}
+
+			continue
+		}
+
+		included, err := v.buildContext.MatchFile(v.realDir(dir), file)
+		if err != nil {
+			if err := v.loadFailed(dir, true, err); err != nil {
+				return "", nil, nil, err
+			}
+
+			continue
+		}
+
+		if !matched || included {
+			continue
+		}
+
+		f, err := parser.ParseFile(token.NewFileSet(),
+			filepath.Join(v.realDir(dir), file), nil,
+			parser.ImportsOnly)
+		if err != nil {
+			if err := v.loadFailed(dir, true, err); err != nil {
+				return "", nil, nil, err
+			}
+
+			continue
+		}
+
+		var paths []string
+		for _, imp := range f.Imports {
+			if path, err := strconv.Unquote(imp.Path.Value); err == nil {
+				paths = append(paths, path)
+			}
+		}
+
+		sort.Strings(paths)
+		if isTest {
+			testImports = unionStrings(testImports, paths)
+		} else {
+			name = f.Name.Name
+			imports = unionStrings(imports, paths)
+		}
+	}
+
+	return name, imports, testImports, nil
+}
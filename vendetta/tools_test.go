@@ -0,0 +1,74 @@
+package vendetta
+
+import (
+	"bytes"
+	"go/build"
+	"strings"
+	"testing"
+)
+
+func toolsTestVendetta(t *testing.T, strict bool) (*vendetta, *bytes.Buffer) {
+	v := testVendetta(t, map[string]string{
+		"x.go":        "package x\n",
+		"tools.go":    "// +build tools\n\npackage x\n\nimport _ \"example.com/tool\"\n",
+		"broken.go":   "// +build ignore\n\npackage main\n\nimport (\n",
+		"gen.go":      "// +build ignore\n\npackage main\n\nimport _ \"example.com/gen\"\n",
+		"gen_test.go": "// +build ignore\n\npackage main\n\nimport _ \"example.com/gentest\"\n",
+	})
+	var out bytes.Buffer
+	v.Stdout = &out
+	v.Strict = strict
+	v.buildContext = build.Default
+	return v, &out
+}
+
+// A file excluded by build constraints that can't be parsed doesn't
+// stop the run, unless -strict is given.
+func TestIgnoredImportsParseError(t *testing.T) {
+	v, out := toolsTestVendetta(t, false)
+	_, imports, _, err := v.ignoredImports("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(imports, " ") != "example.com/gen example.com/tool" {
+		t.Errorf("imports %v", imports)
+	}
+
+	if !strings.Contains(out.String(), "Warning: ") ||
+		!strings.Contains(out.String(), "broken.go") {
+		t.Errorf("no warning about broken.go:\n%s", out.String())
+	}
+
+	v, _ = toolsTestVendetta(t, true)
+	if _, _, _, err := v.ignoredImports(""); err == nil {
+		t.Error("no error with -strict")
+	}
+}
+
+// The imports of ignored test files are kept apart from the others,
+// and only found if tests are wanted.
+func TestIgnoredImportsTests(t *testing.T) {
+	v, _ := toolsTestVendetta(t, false)
+	_, imports, testImports, err := v.ignoredImports("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(imports, " ") != "example.com/gen example.com/tool" {
+		t.Errorf("imports %v", imports)
+	}
+
+	if strings.Join(testImports, " ") != "example.com/gentest" {
+		t.Errorf("test imports %v", testImports)
+	}
+
+	v.NoTests = true
+	if _, _, testImports, err = v.ignoredImports(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if testImports != nil {
+		t.Errorf("test imports %v with -no-tests", testImports)
+	}
+}
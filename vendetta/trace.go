@@ -0,0 +1,65 @@
+package vendetta
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Prepare to run a command at the top level of the repo.  All the git
+// commands are made here, so that they get the same environment, and
+// can be traced.
+func (v *vendetta) command(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = v.rootDir
+	v.envMu.Lock()
+	cmd.Env = v.gitEnv
+	v.envMu.Unlock()
+	return cmd
+}
+
+// With -trace, log a command and where it runs, just before it starts.
+func (v *vendetta) traceStart(cmd *exec.Cmd) {
+	if v.Trace {
+		fmt.Fprintf(v.Stderr, "trace: (in %s) %s\n", cmd.Dir,
+			formatCommand(cmd.Args))
+	}
+}
+
+// With -trace, log the exit status of a command once it has finished,
+// given the error (if any) from running it.
+func (v *vendetta) traceDone(cmd *exec.Cmd, err error) {
+	if !v.Trace {
+		return
+	}
+
+	status := "exit status 0"
+	if err != nil {
+		status = err.Error()
+	}
+
+	fmt.Fprintf(v.Stderr, "trace: %s: %s\n", formatCommand(cmd.Args),
+		status)
+}
+
+// With -trace and -dry-run, log a command that would have been run.
+func (v *vendetta) traceSkipped(name string, args ...string) {
+	if v.Trace {
+		fmt.Fprintf(v.Stderr, "trace: (in %s) would run %s\n",
+			v.rootDir, formatCommand(append([]string{name}, args...)))
+	}
+}
+
+// Format a command line, quoting the arguments that need it.
+func formatCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`*?") {
+			quoted[i] = strconv.Quote(arg)
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,139 @@
+package vendetta
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// With -trim, delete the parts of the working tree of each used
+// submodule under vendor/ that aren't needed by the packages used
+// from it.  This is destructive: the submodules still record their
+// full commits, so they show as modified, and anything needed that
+// the walk can't see (such as C headers in other directories) is
+// lost.  'git submodule update --force' restores the files.
+func (v *vendetta) trimSubmodules() error {
+	if !v.Trim {
+		return nil
+	}
+
+	fmt.Fprintf(v.Stdout, "Warning: -trim deletes files from the working trees of submodules; 'git submodule update --force' restores them\n")
+
+	for i := range v.submodules {
+		sm := &v.submodules[i]
+		if !sm.used || sm.pending || sm.subtree ||
+			!isSubpath(sm.dir, "vendor") {
+			continue
+		}
+
+		fmt.Fprintf(v.Stderr, "Trimming %s\n", sm.dir)
+		if err := v.trimDir(sm.dir, v.reachableDirs(sm.dir), true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Find the directories under top that hold packages reached by the
+// dependency walk.  The result maps each such directory to true, and
+// the directories between top and them to false.
+func (v *vendetta) reachableDirs(top string) map[string]bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	res := make(map[string]bool)
+	for dir := range v.processedDirs {
+		if !isSubpath(dir, top) {
+			continue
+		}
+
+		res[dir] = true
+		for d := parentDir(dir); isSubpath(d, top); d = parentDir(d) {
+			if _, found := res[d]; !found {
+				res[d] = false
+			}
+		}
+	}
+
+	return res
+}
+
+// Delete whatever in dir isn't needed according to reachable.  Files
+// are kept in package directories, and at the top level of the
+// submodule, where licenses and the like live.
+func (v *vendetta) trimDir(dir string, reachable map[string]bool, top bool) error {
+	pkg, keepFiles := reachable[dir]
+	keepFiles = keepFiles || top
+
+	// Keep the subdirectories that the package embeds files from
+	var embedded []string
+	if pkg {
+		if p := v.loadedPackage(dir); p != nil {
+			embedded = p.EmbedPatterns
+		}
+	}
+
+	var remove, descend []string
+	err := readDir(v.realDir(dir), func(fi os.FileInfo) bool {
+		name := fi.Name()
+		sub := filepath.Join(dir, name)
+		_, found := reachable[sub]
+		switch {
+		case name == ".git":
+		case !fi.IsDir():
+			if !keepFiles {
+				remove = append(remove, sub)
+			}
+		case embedsDir(embedded, name):
+		case v.isSubmoduleDir(sub):
+			// A nested submodule gets trimmed separately
+		case found:
+			descend = append(descend, sub)
+		default:
+			remove = append(remove, sub)
+		}
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range descend {
+		if err := v.trimDir(sub, reachable, false); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range remove {
+		if err := os.RemoveAll(v.realDir(path)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Is dir the top of a submodule?
+func (v *vendetta) isSubmoduleDir(dir string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	sm := v.findSubmodule(dir)
+	return sm != nil && sm.dir == dir
+}
+
+// Does one of the //go:embed patterns of a package refer to the
+// subdirectory name (or something in it)?
+func embedsDir(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		first := strings.SplitN(strings.TrimPrefix(pattern, "all:"), "/", 2)[0]
+		if matched, _ := filepath.Match(first, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,46 @@
+package vendetta
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Trimming keeps the packages reached, the top-level files, and
+// nested submodules, which get trimmed separately.
+func TestTrimDir(t *testing.T) {
+	v := testVendetta(t, map[string]string{
+		"vendor/example.com/a/LICENSE":       "license\n",
+		"vendor/example.com/a/a.go":          "package a\n",
+		"vendor/example.com/a/used/u.go":     "package used\n",
+		"vendor/example.com/a/unused/u.go":   "package unused\n",
+		"vendor/example.com/a/nested/n.go":   "package nested\n",
+		"vendor/example.com/a/docs/index.md": "docs\n",
+	})
+	top := filepath.Join("vendor", "example.com", "a")
+	v.addSubmodule(submodule{dir: top, used: true})
+	v.addSubmodule(submodule{dir: filepath.Join(top, "nested"), used: true})
+	v.processedDirs = map[string]struct{}{
+		filepath.Join(top, "used"): {},
+	}
+
+	if err := v.trimDir(top, v.reachableDirs(top), true); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, kept := range map[string]bool{
+		"LICENSE":     true,
+		"a.go":        true,
+		"used/u.go":   true,
+		"nested/n.go": true,
+		"unused":      false,
+		"docs":        false,
+	} {
+		_, err := os.Stat(filepath.Join(v.realDir(top), filepath.FromSlash(path)))
+		if kept && err != nil {
+			t.Errorf("%s was removed (%v)", path, err)
+		} else if !kept && !os.IsNotExist(err) {
+			t.Errorf("%s was kept", path)
+		}
+	}
+}
@@ -0,0 +1,2463 @@
+package vendetta
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TODO:
+//
+// verbose option to print git commands being run
+//
+// Deal with git being fussy when a submodule is removed then re-added
+//
+// warn when it looks like a package ought to be present at the
+// particular path, but it's not.  E.g. when resolve an import of
+// github.com/foo/bar/baz, we find that only github.com/foo exists.
+//
+// check that declared package names match dirs
+//
+// Support relative (aka local) imports
+//
+// Warn on diamond problem
+
+type vendetta struct {
+	*Options
+	goPath
+	buildContext build.Context
+
+	// rootDir is the top-level directory of the git repo, and
+	// scanDir is the directory within it where we look for the
+	// project's packages (relative to rootDir).
+	rootDir string
+	scanDir string
+
+	// mu guards the fields below, which get updated during the
+	// dependency walk, so that the walk can be done by several
+	// goroutines without data races.
+	mu            sync.Mutex
+	goPaths       map[string]*goPath
+	dirPackages   map[string]*build.Package
+	processedDirs map[string]struct{}
+	submodules    []submodule
+
+	// Counts and lists of submodules for the summary
+	preexisting int
+	added       []string
+	removed     []string
+	updated     []string
+
+	// excludes holds the import path prefixes from -exclude and
+	// .vendettaignore
+	excludes []string
+
+	// privatePatterns holds the patterns from GOPRIVATE and
+	// GONOSUMDB, once privateOnce has read them
+	privatePatterns []string
+	privateOnce     sync.Once
+
+	// replaces holds the replace directives from go.mod that
+	// refer to other modules, and replaceRoots the directories of
+	// those that refer to local directories, as extra roots
+	replaces     []replacement
+	replaceRoots []string
+
+	// goModDir is the directory holding the project's go.mod,
+	// modulePath is the module path from it, and requires maps
+	// the modules it requires to their versions
+	goModDir   string
+	modulePath string
+	requires   map[string]string
+
+	// clones holds the submodules waiting to be cloned, and
+	// deferred the imports waiting for them
+	clones   []pendingClone
+	deferred []deferredScan
+
+	// gitConfig holds the settings (as key, value pairs) given to
+	// git through the environment, to supply credentials, and
+	// gitEnv is the resulting environment for commands, if it
+	// needs to differ from ours.  Rules from the config file add
+	// settings during the dependency walk, so envMu guards them.
+	envMu     sync.Mutex
+	gitConfig []string
+	gitEnv    []string
+
+	// failures counts the errors passed over with -keep-going
+	failures int
+
+	// goProxy is the GOPROXY setting, with -goproxy
+	goProxy string
+
+	// notInManifest and notImported hold the differences from
+	// the -manifest file
+	notInManifest []string
+	notImported   []string
+
+	// stdlibPkgs holds the packages reported by -show-stdlib
+	stdlibPkgs map[string]struct{}
+
+	// rules holds the rules from the config file
+	rules []repoRule
+
+	// extraRoots holds the goPaths for the projects given by
+	// Options.ExtraRoots
+	extraRoots []*goPath
+
+	// For the stats
+	start        time.Time
+	gitTime      time.Duration
+	resolvedPkgs map[string]struct{}
+}
+
+// A goPath says where to search for packages (analogous to
+// GOPATH). Different directories have different gopaths because there
+// can be vendor directories anywhere, not just at the top level.
+// These gopaths are produced by getGoPath and memoized in the goPaths
+// map.
+type goPath struct {
+	dir  string
+	next *goPath
+
+	// prefixes is nil for goPaths corresponding to vendor
+	// directories.  But there is also a goPath corresponding to
+	// the top-level project directory.  When searching for a
+	// package in that top-level directory, we need to remove any
+	// prefix of the package name corresponding to the root name
+	// of the project (e.g. github.com/user/proj).  prefixes is
+	// the set of such prefixes.
+	prefixes map[string]struct{}
+}
+
+type submodule struct {
+	dir  string
+	used bool
+
+	// pending is set for submodules that have not been added
+	// because we are not making changes, and url and branch are
+	// the repo URL and branch to track for them.
+	pending bool
+	url     string
+	branch  string
+
+	// major is the major version suffix of the module a pending
+	// submodule is being cloned for (see majorSuffix).
+	major string
+
+	// subtree is set if this is really a subtree added with
+	// -mode subtree.
+	subtree bool
+
+	// direct is set if packages in the project import packages
+	// in the submodule, rather than it only being needed by
+	// other dependencies.
+	direct bool
+
+	// testOnly is set if the submodule is only needed by the
+	// tests of packages in the project.
+	testOnly bool
+}
+
+func (v *vendetta) run() error {
+	switch v.Mode {
+	case "", ModeSubmodule, ModeSubtree:
+	default:
+		return usageErrorf("Invalid mode '%s' (should be submodule or subtree)", v.Mode)
+	}
+
+	if v.Check && v.Manifest == "" {
+		return usageErrorf("-check needs a -manifest file to check against")
+	}
+
+	switch v.StaleDirs {
+	case "", StaleFail, StaleReplace, StaleSkip:
+	default:
+		return usageErrorf("Invalid -stale-dirs value '%s' (should be fail, replace or skip)", v.StaleDirs)
+	}
+
+	if v.Offline && v.Update {
+		return usageErrorf("Updating submodules requires network access, so can't be done offline")
+	}
+
+	if v.Incremental && (v.Prune || v.List || v.DiffOnly || v.ModulesTxt || v.UseGoList) {
+		return usageErrorf("-incremental only scans part of the project, so can't be combined with -p, -list, -diff-only, -modules-txt or -use-golist")
+	}
+
+	if v.Packages != nil && (v.Prune || v.ModulesTxt || v.UseGoList || v.Incremental) {
+		return usageErrorf("-packages doesn't scan the project, so can't be combined with -p, -modules-txt, -use-golist or -incremental")
+	}
+
+	if v.FailFast && v.KeepGoing {
+		return usageErrorf("-fail-fast and -keep-going are contradictory")
+	}
+
+	if v.Trim && (v.Incremental || v.NoRecurseDeps || v.Mode == ModeSubtree) {
+		return usageErrorf("-trim needs to see every package used from each submodule, so can't be combined with -incremental, -no-recurse-deps or -mode subtree")
+	}
+
+	if len(v.Clean) > 0 && (v.Offline || !v.mutating()) {
+		return usageErrorf("Cleaning submodules re-clones them, so can't be done offline or with -list")
+	}
+
+	if err := v.setupBuildContext(); err != nil {
+		return err
+	}
+
+	if err := v.normalizeRootDir(); err != nil {
+		return err
+	}
+
+	if err := v.findGitTopLevel(); err != nil {
+		return err
+	}
+
+	if err := v.checkVendorDir(); err != nil {
+		return err
+	}
+
+	if err := v.checkVendorRepo(); err != nil {
+		return err
+	}
+
+	if err := v.readConfig(); err != nil {
+		return err
+	}
+
+	if err := v.expandRuleURLs(); err != nil {
+		return err
+	}
+
+	if err := v.readCredentials(); err != nil {
+		return err
+	}
+
+	ignored, err := v.readIgnoreFile()
+	if err != nil {
+		return err
+	}
+
+	v.excludes = append(ignored, v.Exclude...)
+	if v.GoProxy {
+		if v.goProxy = goEnv("GOPROXY"); v.goProxy == "" {
+			v.goProxy = defaultGoProxy
+		}
+	}
+
+	if err := v.readGoMod(); err != nil {
+		return err
+	}
+
+	var rootPkgs []rootPackage
+	var goListDeps []string
+	switch {
+	case v.Packages != nil:
+		// The packages to vendor were given explicitly
+	case v.UseGoList:
+		rootPkgs, goListDeps, err = v.goListRootProject()
+	default:
+		rootPkgs, err = v.scanRootProject()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if v.ProjectName != "" {
+		if err := checkProjectName(v.ProjectName); err != nil {
+			return usageErrorf("%s", err)
+		}
+
+		v.prefixes[v.ProjectName] = struct{}{}
+	} else {
+		v.inferProjectNameFromGoMod()
+
+		if err := v.inferProjectNameFromGoPath(); err != nil {
+			return err
+		}
+
+		if err := v.inferProjectNameFromGit(); err != nil {
+			return err
+		}
+
+		v.inferProjectNameFromImportComments(rootPkgs)
+
+		if !mainOnly(rootPkgs) && len(v.prefixes) == 0 {
+			return &ProjectInferenceError{Dir: v.realDir(v.scanDir),
+				Hint: "specify it explicitly with the '-n' option"}
+		}
+	}
+
+	extraPkgs, err := v.scanExtraRoots()
+	if err != nil {
+		return err
+	}
+
+	rootPkgs = append(rootPkgs, extraPkgs...)
+
+	if err := v.checkOrphanedSubmodules(); err != nil {
+		return err
+	}
+
+	if v.Init && v.mutating() {
+		if err := v.initSubmodules(); err != nil {
+			return err
+		}
+	}
+
+	if err := v.checkSubmodules(); err != nil {
+		return err
+	}
+
+	if !v.IgnoreExisting {
+		if err := v.populateSubmodules(); err != nil {
+			return err
+		}
+	}
+
+	if err := v.checkProjectOverlap(); err != nil {
+		return err
+	}
+
+	if err := v.cleanSubmodules(); err != nil {
+		return err
+	}
+
+	if err := v.resolveRootProjectDeps(rootPkgs); err != nil {
+		return err
+	}
+
+	// "go list -deps" already told us about indirect
+	// dependencies, so make sure they are all present, even if
+	// scanning the vendored packages wouldn't find them.
+	if err := v.resolveDependencies(v.scanDir, goListDeps); err != nil {
+		return err
+	}
+
+	// Packages given with -add or -packages are treated as if
+	// the project imported them.
+	if err := v.resolveDependencies(v.scanDir, v.Add); err != nil {
+		return err
+	}
+
+	if err := v.resolveDependencies(v.scanDir, v.Packages); err != nil {
+		return err
+	}
+
+	if err := v.finishClones(); err != nil {
+		return err
+	}
+
+	if err := v.resolveRootTestDeps(rootPkgs); err != nil {
+		return err
+	}
+
+	if err := v.checkRequiredVersions(); err != nil {
+		return err
+	}
+
+	if err := v.compareManifest(); err != nil {
+		return err
+	}
+
+	if v.IgnoreExisting {
+		if err := v.compareResolvedURLs(); err != nil {
+			return err
+		}
+	}
+
+	if v.PreviewGitmodules {
+		return v.previewGitmodules()
+	}
+
+	if !v.mutating() {
+		return nil
+	}
+
+	if err := v.pruneSubmodules(); err != nil {
+		return err
+	}
+
+	if err := v.trimSubmodules(); err != nil {
+		return err
+	}
+
+	if err := v.canonicalizeGitmodules(); err != nil {
+		return err
+	}
+
+	if v.RewriteImports {
+		if err := v.rewriteImports(); err != nil {
+			return err
+		}
+	}
+
+	if v.ModulesTxt {
+		if err := v.writeModulesTxt(); err != nil {
+			return err
+		}
+	}
+
+	if err := v.runAfterAdd(); err != nil {
+		return err
+	}
+
+	if v.VerifyBuild {
+		return v.verifyBuild()
+	}
+
+	return nil
+}
+
+// Check that the vendor directory is not a symlink.  We can still
+// read packages through it, but git doesn't follow symlinks, so it
+// can't add submodules under it.
+func (v *vendetta) checkVendorDir() error {
+	fi, err := os.Lstat(v.realDir("vendor"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if fi.Mode()&os.ModeSymlink == 0 || !v.mutating() {
+		return nil
+	}
+
+	target, err := os.Readlink(v.realDir("vendor"))
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("The vendor directory is a symbolic link to %s.  git can't add submodules under a symbolic link, so replace it with a real directory (or run vendetta in the repo it points into).", target)
+}
+
+// Set up the build.Context used to read packages, so that we see the
+// imports relevant to the target platform.
+func (v *vendetta) setupBuildContext() error {
+	v.buildContext = build.Default
+	ctx := &v.buildContext
+
+	// With -isolated, the settings that build.Default takes from
+	// the environment come from how vendetta was built instead,
+	// and packages are only found in the project and GOROOT.
+	if v.Isolated {
+		ctx.GOROOT = runtime.GOROOT()
+		ctx.GOPATH = ""
+		ctx.GOOS, ctx.GOARCH = runtime.GOOS, runtime.GOARCH
+	}
+
+	if v.GOPATH != "" {
+		ctx.GOPATH = v.GOPATH
+	}
+
+	if v.GOROOT != "" {
+		if fi, err := os.Stat(filepath.Join(v.GOROOT, "src")); err != nil || !fi.IsDir() {
+			return usageErrorf("'%s' given for -goroot doesn't look like a Go installation", v.GOROOT)
+		}
+
+		ctx.GOROOT = v.GOROOT
+	}
+
+	if v.GOOS != "" {
+		if !knownOS[v.GOOS] {
+			return usageErrorf("Unknown operating system '%s' given for -goos", v.GOOS)
+		}
+
+		ctx.GOOS = v.GOOS
+	}
+
+	if v.GOARCH != "" {
+		if !knownArch[v.GOARCH] {
+			return usageErrorf("Unknown architecture '%s' given for -goarch", v.GOARCH)
+		}
+
+		ctx.GOARCH = v.GOARCH
+	}
+
+	// Explicit tags override any given in GOFLAGS
+	tags := v.Tags
+	if len(tags) == 0 {
+		var err error
+		if tags, err = goflagsTags(); err != nil {
+			return err
+		}
+	}
+
+	ctx.BuildTags = append(ctx.BuildTags, tags...)
+
+	// Like the go tool, disable cgo when cross-compiling, unless
+	// it is explicitly enabled.
+	if (ctx.GOOS != build.Default.GOOS ||
+		ctx.GOARCH != build.Default.GOARCH) &&
+		os.Getenv("CGO_ENABLED") != "1" {
+		ctx.CgoEnabled = false
+	}
+
+	return nil
+}
+
+// Make rootDir an absolute, clean path, expanding a leading ~, and
+// check that it is a directory.  Otherwise, odd paths can lead to
+// confusing errors later on.
+func (v *vendetta) normalizeRootDir() error {
+	dir := v.rootDir
+	if dir == "~" || strings.HasPrefix(dir, "~"+string(os.PathSeparator)) ||
+		strings.HasPrefix(dir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+
+		dir = filepath.Join(home, dir[1:])
+	}
+
+	if dir == "" {
+		dir = "."
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return usageErrorf("The project directory %s does not exist", dir)
+		}
+
+		return err
+	}
+
+	if !fi.IsDir() {
+		return usageErrorf("The project directory %s is not a directory", dir)
+	}
+
+	v.rootDir = dir
+	return nil
+}
+
+// Make rootDir refer to the top-level directory of the git repo,
+// because that is where the vendor directory and .gitmodules live.
+// If we were pointed at a subdirectory, or one was given with
+// Options.SubDir, only the packages under it get scanned.
+func (v *vendetta) findGitTopLevel() error {
+	out, err := v.popen("git", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+
+	defer out.close()
+
+	var top string
+	if out.Scan() {
+		top = filepath.FromSlash(out.Text())
+	}
+
+	if err := out.close(); err != nil || top == "" {
+		return fmt.Errorf("%s does not seem to be inside a git repository", v.realDir(""))
+	}
+
+	dir, err := filepath.Abs(v.realDir(""))
+	if err != nil {
+		return err
+	}
+
+	// git resolves symlinks in the path it reports, so we need
+	// to do the same before comparing.
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(top, dir)
+	if err != nil {
+		return err
+	}
+
+	if v.SubDir != "" {
+		rel = filepath.Clean(filepath.FromSlash(v.SubDir))
+		if filepath.IsAbs(rel) || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			return usageErrorf("The subdirectory '%s' should be relative to the top level of the git repository", v.SubDir)
+		}
+
+		fi, err := os.Stat(filepath.Join(top, rel))
+		if err != nil {
+			return err
+		}
+
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", filepath.Join(top, rel))
+		}
+	}
+
+	if rel != "." {
+		fmt.Fprintf(v.Stderr, "Using git repository at %s\n", top)
+		v.rootDir = top
+		v.scanDir = rel
+	}
+
+	return nil
+}
+
+// Attempt to infer the project name from GOPATH, by seeing if the
+// project dir resides under any element of the GOPATH.
+func (v *vendetta) inferProjectNameFromGoPath() error {
+	gp := os.Getenv("GOPATH")
+	if v.GOPATH != "" || v.Isolated {
+		gp = v.buildContext.GOPATH
+	}
+	if gp == "" {
+		return nil
+	}
+
+	gpparts := filepath.SplitList(gp)
+	gpfis := make([]os.FileInfo, len(gpparts))
+	for i, p := range gpparts {
+		var err error
+		gpfis[i], err = os.Stat(filepath.Join(p, "src"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+	}
+
+	// Get the absolute path to the project dir
+	dir := v.rootDir
+	if dir == "" {
+		dir = "."
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	// walk from the project dir upwards towards the filesystem root
+	var proj, projsep string
+	for {
+		var subdir string
+		dir, subdir = filepath.Split(dir)
+
+		proj = subdir + projsep + proj
+		projsep = "/"
+
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+
+		for i, gpfi := range gpfis {
+			if gpfi != nil && os.SameFile(fi, gpfi) {
+				v.inferredProjectName(proj, "GOPATH element",
+					gpparts[i])
+				return nil
+			}
+		}
+
+		if dir != "" && dir[len(dir)-1] == os.PathSeparator {
+			dir = dir[:len(dir)-1]
+		}
+
+		if dir == "" {
+			return nil
+		}
+	}
+}
+
+var remoteUrlRE = regexp.MustCompile(`^(?:https://github\.com/|git@github\.com:)(.*\.?)$`)
+
+// Infer the project name from the fetch URL of the origin remote,
+// or of the first remote if there is no origin.  Other remotes (e.g.
+// forks) are ignored, so that the result is predictable in repos with
+// several remotes.
+func (v *vendetta) inferProjectNameFromGit() error {
+	remotes, err := v.popen("git", "remote", "-v")
+	if err != nil {
+		return err
+	}
+
+	defer remotes.close()
+
+	var remote, url string
+	for remotes.Scan() {
+		// Lines look like "origin	<url> (fetch)".  Skip
+		// anything else, and the push URLs.
+		fields := splitWS(strings.TrimSpace(remotes.Text()))
+		if len(fields) < 2 || len(fields) > 2 && fields[2] == "(push)" {
+			continue
+		}
+
+		if remote == "" || fields[0] == "origin" && remote != "origin" {
+			remote, url = fields[0], fields[1]
+		}
+	}
+
+	if err := remotes.close(); err != nil {
+		return err
+	}
+
+	if m := remoteUrlRE.FindStringSubmatch(url); m != nil {
+		name := m[1]
+		if strings.HasSuffix(name, ".git") {
+			name = name[:len(name)-4]
+		}
+
+		v.inferredProjectName("github.com/"+name, "git remote", remote)
+	}
+
+	return nil
+}
+
+// Infer the project name from the module path in go.mod.  Only this
+// gets the major version suffix of a module at v2 or later right.
+func (v *vendetta) inferProjectNameFromGoMod() {
+	if v.modulePath == "" {
+		return
+	}
+
+	if proj, ok := projectFromImportComment(v.modulePath, v.goModDir); ok {
+		v.inferredProjectName(proj, "go.mod")
+	}
+}
+
+func (v *vendetta) inferProjectNameFromImportComments(rootPkgs []rootPackage) {
+	for _, pkg := range rootPkgs {
+		ic := pkg.ImportComment
+		if ic == "" {
+			continue
+		}
+
+		if proj, ok := projectFromImportComment(ic, pkg.dir); ok {
+			v.inferredProjectName(proj, "import comment in",
+				v.realDir(pkg.dir))
+		}
+	}
+}
+
+// Work out the project name from the import comment of a package at
+// dir within the project.
+func projectFromImportComment(ic, dir string) (string, bool) {
+	// For an import comment to suggest a project name, it should
+	// have the path of the package within the project as a
+	// suffix.
+	if dir != "" {
+		suffix := pathToPackage(dir)
+		if len(ic) <= len(suffix) ||
+			ic[len(ic)-len(suffix):] != suffix &&
+				ic[len(ic)-len(suffix)-1] != '/' {
+			return "", false
+		}
+
+		ic = ic[:len(ic)-len(suffix)-1]
+	}
+
+	return ic, true
+}
+
+// Check that a project name is plausible as the import path of the
+// root of a project.  A bare host name (as inferred from a malformed
+// git remote like "git@github.com:", say) would make every package on
+// the host look like part of the project.
+func checkProjectName(name string) error {
+	bits := strings.Split(name, "/")
+	for _, bit := range bits {
+		if bit == "" || bit == "." || bit == ".." {
+			return fmt.Errorf("The project name '%s' is not a valid import path", name)
+		}
+	}
+
+	// On a well-known host, the project should contain a whole
+	// repo.  Pad the name to see how long a repo root is there.
+	if site := hostingSite(bits[0]); site != nil {
+		loc, err := site(append(bits, "x", "x", "x", "x"))
+		if err == nil {
+			if len(loc.root) > len(name) {
+				return fmt.Errorf("The project name '%s' is too short for a project on %s", name, bits[0])
+			}
+
+			return nil
+		}
+	}
+
+	if len(bits) == 1 && strings.Contains(name, ".") {
+		return fmt.Errorf("The project name '%s' is just a host name", name)
+	}
+
+	return nil
+}
+
+func (v *vendetta) inferredProjectName(proj string, source ...interface{}) {
+	if err := checkProjectName(proj); err != nil {
+		fmt.Fprintf(v.Stdout, "Warning: %s, so ignoring it (inferred from %s)\n", err,
+			strings.TrimSuffix(fmt.Sprintln(source...), "\n"))
+		return
+	}
+
+	if _, found := v.prefixes[proj]; !found {
+		fmt.Fprintln(v.Stdout, append([]interface{}{
+			"Inferred root package name", proj, "from",
+		}, source...)...)
+		v.prefixes[proj] = struct{}{}
+	}
+}
+
+// With -init or -recursive-submodules, make sure submodules (and
+// submodules within them) are checked out, as when a repo is cloned
+// without --recurse-submodules.  If dirs are given, only those
+// submodules are initialized.
+func (v *vendetta) initSubmodules(dirs ...string) error {
+	fmt.Fprintf(v.Stderr, "Initializing submodules\n")
+	args := []string{"submodule", "update", "--init", "--recursive"}
+	if len(dirs) == 0 {
+		return v.git(args...)
+	}
+
+	// The dirs are dependency submodules
+	args = append(args, "--")
+	for _, dir := range dirs {
+		args = append(args, v.depsPath(dir))
+	}
+
+	return v.depsGit(args...)
+}
+
+// Check for submodules that seem to be missing in the working tree.
+func (v *vendetta) checkSubmodules() error {
+	var err2 error
+	if err := v.querySubmodules("", func(path string) bool {
+		err2 = v.checkSubmodule(path)
+		return err2 == nil
+	}, "--recursive"); err != nil {
+		return err
+	}
+
+	return err2
+}
+
+func (v *vendetta) checkSubmodule(dir string) error {
+	foundSomething := false
+	if err := readDir(v.realDir(dir), func(fi os.FileInfo) bool {
+		foundSomething = true
+		return false
+	}); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if !foundSomething {
+		return fmt.Errorf("The submodule '%s' doesn't seem to the present in the working tree.  Maybe you forgot to update with 'git submodule update --init --recursive' (or use -init)?", dir)
+	}
+
+	return nil
+}
+
+// Call f with the path of each submodule of the repo at dir (relative
+// to the top level of the project's repo), until it returns false.
+func (v *vendetta) querySubmodules(dir string, f func(string) bool, args ...string) error {
+	args = append([]string{"submodule", "status"}, args...)
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+
+	status, err := v.popen("git", args...)
+	if err != nil {
+		return err
+	}
+
+	defer status.close()
+
+	for status.Scan() {
+		path, ok := parseSubmoduleStatus(status.Text())
+		if !ok {
+			continue
+		}
+
+		if !f(filepath.Join(dir, path)) {
+			return nil
+		}
+	}
+
+	return status.close()
+}
+
+// Extract the path from a line of 'git submodule status' output.
+// Lines look like
+//
+//	<flag><sha> <path> (<describe>)
+//
+// where the flag is a space, or '-' (not initialized), '+'
+// (different commit checked out) or 'U' (merge conflicts).  The
+// describe part may be missing.  Paths can contain spaces, so we
+// don't just split the line into fields.  Lines that don't fit the
+// pattern are reported as not ok.
+func parseSubmoduleStatus(line string) (string, bool) {
+	if len(line) < 2 || !strings.ContainsRune(" -+U", rune(line[0])) {
+		return "", false
+	}
+
+	sp := strings.IndexByte(line[1:], ' ')
+	if sp <= 0 {
+		return "", false
+	}
+
+	path := line[sp+2:]
+	if strings.HasSuffix(path, ")") {
+		if paren := strings.LastIndex(path, " ("); paren >= 0 {
+			path = path[:paren]
+		}
+	}
+
+	if path == "" {
+		return "", false
+	}
+
+	return filepath.FromSlash(path), true
+}
+
+func (v *vendetta) populateSubmodules() error {
+	var submodules []string
+	vendorRepo := false
+	add := func(path string) bool {
+		// If vendor/ is a submodule, it is the vendor repo
+		// that holds the dependency submodules, rather than a
+		// dependency itself.
+		if path == "vendor" {
+			vendorRepo = true
+		} else {
+			submodules = append(submodules, path)
+		}
+
+		return true
+	}
+
+	if err := v.querySubmodules("", add); err != nil {
+		return err
+	}
+
+	if vendorRepo && !v.VendorRepo {
+		return usageErrorf("vendor/ is a submodule, so use -vendor-repo to add the dependencies to it")
+	}
+
+	if v.VendorRepo {
+		if err := v.querySubmodules(v.depsRepo(), add); err != nil {
+			return err
+		}
+	}
+
+	subtrees := make(map[string]bool)
+	if v.subtreeMode() {
+		dirs, err := v.querySubtrees()
+		if err != nil {
+			return err
+		}
+
+		for _, dir := range dirs {
+			subtrees[dir] = true
+			submodules = append(submodules, dir)
+		}
+	}
+
+	sort.Strings(submodules)
+
+	gitmodules, err := v.readGitmodules()
+	if err != nil {
+		return err
+	}
+
+	v.submodules = make([]submodule, 0, len(submodules))
+	for _, p := range submodules {
+		sm := submodule{dir: p, subtree: subtrees[p]}
+		if gm := gitmodules[p]; gm != nil {
+			sm.url = gm.url
+		}
+
+		v.submodules = append(v.submodules, sm)
+		if isSubpath(p, "vendor") {
+			v.preexisting++
+		}
+	}
+
+	return nil
+}
+
+// Find the submodule containing path.  A copy of it is returned, as
+// the submodules slice can change once mu is released.
+func (v *vendetta) pathInSubmodule(path string) (submodule, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	sm := v.findSubmodule(path)
+	if sm == nil {
+		return submodule{}, false
+	}
+
+	return *sm, true
+}
+
+// Mark the submodule containing path as used.  If it was not already
+// marked, a copy of it is returned.
+func (v *vendetta) useSubmodule(path string) (submodule, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	sm := v.findSubmodule(path)
+	if sm == nil || sm.used {
+		return submodule{}, false
+	}
+
+	sm.used = true
+	return *sm, true
+}
+
+// Find a submodule cloned from the same repo as repoURL for the same
+// major version, and mark it as used.  A module with a major version
+// suffix can need its own copy of a repo (see placeMajorVersion), so
+// the repo alone doesn't identify the submodule.
+func (v *vendetta) useSubmoduleWithURL(repoURL, major string) *submodule {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	norm := normalizeRepoURL(repoURL)
+	for i := range v.submodules {
+		sm := &v.submodules[i]
+		if sm.url != "" && normalizeRepoURL(sm.url) == norm &&
+			sm.majorVersion() == major {
+			sm.used = true
+			res := *sm
+			return &res
+		}
+	}
+
+	return nil
+}
+
+// Find a submodule strictly inside dir, returning a copy of it.
+func (v *vendetta) submoduleWithin(dir string) (submodule, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, sm := range v.submodules {
+		if sm.dir != dir && isSubpath(sm.dir, dir) {
+			return sm, true
+		}
+	}
+
+	return submodule{}, false
+}
+
+// If the importing directory is part of the project, mark the
+// submodule containing pkgdir as a direct dependency.
+func (v *vendetta) markDirect(importer, pkgdir string) {
+	if inVendorDir(importer) {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if sm := v.findSubmodule(pkgdir); sm != nil {
+		sm.direct = true
+	}
+}
+
+// Find the submodule containing path.  v.mu must be held.
+//
+// We look for a submodule at path itself, then at each of its parent
+// directories in turn, so the innermost submodule wins.  It's not
+// enough to check the submodule that sorts just before path: e.g.
+// vendor/foo/bar-x sorts between vendor/foo/bar and
+// vendor/foo/bar/baz.
+func (v *vendetta) findSubmodule(path string) *submodule {
+	for dir := path; dir != ""; dir = parentDir(dir) {
+		i := sort.Search(len(v.submodules), func(i int) bool {
+			return v.submodules[i].dir >= dir
+		})
+		if i < len(v.submodules) && v.submodules[i].dir == dir {
+			return &v.submodules[i]
+		}
+	}
+
+	return nil
+}
+
+func (v *vendetta) addSubmodule(sm submodule) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	i := sort.Search(len(v.submodules), func(i int) bool {
+		return v.submodules[i].dir >= sm.dir
+	})
+
+	submodules := make([]submodule, len(v.submodules)+1)
+	copy(submodules, v.submodules[:i])
+	submodules[i] = sm
+	copy(submodules[i+1:], v.submodules[i:])
+	v.submodules = submodules
+	if !sm.pending {
+		v.added = append(v.added, sm.dir)
+	}
+}
+
+// Whether we should make changes to the repo.  Otherwise, we just
+// work out what the changes would be.
+func (v *vendetta) mutating() bool {
+	return !v.List && !v.DryRun && !v.PreviewGitmodules &&
+		!v.IgnoreExisting && !v.DiffOnly
+}
+
+// Find a submodule outside vendor/ whose path suggests that it
+// holds the given project, e.g. third_party/github.com/foo/bar for
+// github.com/foo/bar.  Such submodules are probably left over from
+// some other vendoring scheme.
+func (v *vendetta) submoduleOutsideVendor(basePkg string) *submodule {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	suffix := packageToPath(basePkg)
+	for i := range v.submodules {
+		sm := &v.submodules[i]
+		if isSubpath(sm.dir, "vendor") {
+			continue
+		}
+
+		if sm.dir == suffix || strings.HasSuffix(sm.dir,
+			string(os.PathSeparator)+suffix) {
+			return sm
+		}
+	}
+
+	return nil
+}
+
+// Is path within dir?  Both are relative to the top level of the
+// repo, which is given as "" and so contains every path.
+func isSubpath(path, dir string) bool {
+	return isSubpathSep(path, dir, os.PathSeparator)
+}
+
+// isSubpath with the separator given, so that the handling of both
+// '/' and '\' can be tested on any OS.
+func isSubpathSep(path, dir string, sep byte) bool {
+	if dir == "" {
+		return true
+	}
+
+	return path == dir ||
+		(strings.HasPrefix(path, dir) && path[len(dir)] == sep)
+}
+
+func (v *vendetta) updateSubmodule(sm *submodule) error {
+	gm, branch, err := v.updateBranch(sm)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(v.Stderr, "Updating submodule %s from remote branch %s\n",
+		sm.dir, branch)
+	before, err := v.submoduleHead(sm.dir)
+	if err != nil {
+		return err
+	}
+
+	if err := v.depsGit("-c", "submodule."+gm.name+".branch="+branch,
+		"submodule", "update", "--remote", "--recursive",
+		v.depsPath(sm.dir)); err != nil {
+		return err
+	}
+
+	after, err := v.submoduleHead(sm.dir)
+	if err != nil {
+		return err
+	}
+
+	if after != before {
+		v.mu.Lock()
+		v.updated = append(v.updated, sm.dir)
+		v.mu.Unlock()
+	}
+
+	// If we don't put the updated submodule into the index, a
+	// subsequent "git submodule update" will revert it, which can
+	// lead to surprises.
+	return v.depsGit("add", v.depsPath(sm.dir))
+}
+
+// Work out which remote branch to update a submodule from.
+func (v *vendetta) updateBranch(sm *submodule) (*gitmodule, string, error) {
+	if sm.subtree {
+		return nil, "", fmt.Errorf("Updating subtrees is not supported; use 'git subtree pull --prefix %s' to update %s", filepath.ToSlash(sm.dir), sm.dir)
+	}
+
+	gitmodules, err := v.readGitmodules()
+	if err != nil {
+		return nil, "", err
+	}
+
+	gm := gitmodules[sm.dir]
+	if gm == nil {
+		return nil, "", fmt.Errorf("submodule %s not found in .gitmodules", sm.dir)
+	}
+
+	// Use the branch recorded in .gitmodules.  If there isn't
+	// one, use the remote's default branch, rather than whatever
+	// default this version of git assumes.
+	branch := gm.branch
+	if branch == "" {
+		if branch, err = v.remoteHeadBranch(sm.dir, "origin"); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return gm, branch, nil
+}
+
+// Patterns in git's error messages when fetching fails, and what
+// they suggest is wrong.  The patterns are matched against the
+// lowercased messages, in order.
+var fetchProblems = []struct {
+	patterns []string
+	problem  string
+}{
+	{[]string{"repository not found", "not found", "error: 404",
+		"does not appear to be a git repository", "does not exist"},
+		"its remote repo was not found, so may have been deleted or renamed"},
+	{[]string{"authentication failed", "could not read username",
+		"could not read password", "permission denied",
+		"terminal prompts disabled", "error: 403"},
+		"access to its remote repo was denied, so it may have been made private, or need credentials"},
+	{[]string{"could not resolve host", "connection timed out",
+		"connection refused", "network is unreachable",
+		"operation timed out", "connection reset", "early eof"},
+		"its remote repo could not be reached over the network"},
+}
+
+// Deal with a failure to update a submodule.  If fetching from its
+// remote failed, say why, going by git's error messages.  With
+// -keep-going, report that and carry on with the submodule as it is.
+func (v *vendetta) updateFailed(sm *submodule, err error) error {
+	var ge *GitCommandError
+	if !errors.As(err, &ge) {
+		return err
+	}
+
+	stderr := strings.ToLower(ge.Stderr)
+	for _, fp := range fetchProblems {
+		for _, pattern := range fp.patterns {
+			if !strings.Contains(stderr, pattern) {
+				continue
+			}
+
+			uerr := &UpdateError{Dir: sm.dir, Problem: fp.problem,
+				Err: err}
+			if !v.KeepGoing {
+				return uerr
+			}
+
+			v.keepGoing(uerr)
+			return nil
+		}
+	}
+
+	return err
+}
+
+// With -dry-run, report what updating a submodule would do, without
+// changing it.  This fetches the remote branch into the submodule's
+// repo, to count the new commits, but leaves the checkout alone.
+func (v *vendetta) previewUpdate(sm *submodule) error {
+	_, branch, err := v.updateBranch(sm)
+	if err != nil {
+		return err
+	}
+
+	head, err := v.submoduleHead(sm.dir)
+	if err != nil {
+		return err
+	}
+
+	if err := v.git("-C", sm.dir, "fetch", "-q", "origin", branch); err != nil {
+		return err
+	}
+
+	remote, err := v.popen("git", "-C", sm.dir, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return err
+	}
+
+	defer remote.close()
+
+	var fetched string
+	if remote.Scan() {
+		fetched = remote.Text()
+	}
+
+	if err := remote.close(); err != nil {
+		return err
+	}
+
+	if fetched == head {
+		fmt.Fprintf(v.Stdout, "%s: up to date with origin/%s (%.12s)\n", sm.dir,
+			branch, head)
+		return nil
+	}
+
+	count, err := v.popen("git", "-C", sm.dir, "rev-list", "--count",
+		head+".."+fetched)
+	if err != nil {
+		return err
+	}
+
+	defer count.close()
+
+	var behind string
+	if count.Scan() {
+		behind = count.Text()
+	}
+
+	if err := count.close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(v.Stdout, "%s: %s commits behind origin/%s (%.12s -> %.12s)\n",
+		sm.dir, behind, branch, head, fetched)
+	return nil
+}
+
+// Get the commit checked out in a submodule.
+func (v *vendetta) submoduleHead(dir string) (string, error) {
+	head, err := v.popen("git", "-C", dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	defer head.close()
+
+	var commit string
+	if head.Scan() {
+		commit = head.Text()
+	}
+
+	return commit, head.close()
+}
+
+// Find the default branch of a remote, from the perspective of the
+// repo at dir.
+func (v *vendetta) remoteHeadBranch(dir, remote string) (string, error) {
+	args := []string{"ls-remote", "--symref", remote, "HEAD"}
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+
+	head, err := v.popen("git", args...)
+	if err != nil {
+		return "", err
+	}
+
+	defer head.close()
+
+	// The output we are looking for looks like
+	// "ref: refs/heads/master	HEAD"
+	var branch string
+	for head.Scan() {
+		fields := splitWS(strings.TrimSpace(head.Text()))
+		if len(fields) >= 2 && fields[0] == "ref:" {
+			branch = strings.TrimPrefix(fields[1], "refs/heads/")
+		}
+	}
+
+	if err := head.close(); err != nil {
+		return "", err
+	}
+
+	if branch == "" {
+		return "", fmt.Errorf("could not find the default branch of %s", remote)
+	}
+
+	return branch, nil
+}
+
+func (v *vendetta) pruneSubmodules() error {
+	for _, sm := range v.submodules {
+		if sm.used || !isSubpath(sm.dir, "vendor") {
+			continue
+		}
+
+		if v.Prune {
+			fmt.Fprintf(v.Stderr, "Removing unused submodule %s\n",
+				sm.dir)
+			path := v.depsPath(sm.dir)
+			args := []string{"rm", "-f", path}
+			if sm.subtree {
+				args = []string{"rm", "-r", "-q", "-f", path}
+			}
+
+			if err := v.depsGit(args...); err != nil {
+				return err
+			}
+
+			if err := v.removeEmptyDirsAbove(sm.dir); err != nil {
+				return err
+			}
+
+			v.removed = append(v.removed, sm.dir)
+		} else {
+			fmt.Fprintf(v.Stderr, "Unused submodule %s (use -p option to prune)\n", sm.dir)
+		}
+	}
+
+	return nil
+}
+
+func (v *vendetta) removeEmptyDirsAbove(dir string) error {
+	for {
+		dir = parentDir(dir)
+		if dir == "" {
+			return nil
+		}
+
+		empty := true
+		if err := readDir(v.realDir(dir), func(_ os.FileInfo) bool {
+			empty = false
+			return false
+		}); err != nil {
+			// git may already have removed it
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+
+		if !empty {
+			return nil
+		}
+
+		if err := os.Remove(v.realDir(dir)); err != nil {
+			return err
+		}
+	}
+}
+
+// Get the directory name from a path.  path.Dir doesn't
+// do what we want in the case where there is no path
+// separator:
+func parentDir(path string) string {
+	slash := strings.LastIndexByte(path, os.PathSeparator)
+	dir := ""
+	if slash >= 0 {
+		dir = path[:slash]
+	}
+	return dir
+}
+
+var wsRE = regexp.MustCompile(`[ \t]+`)
+
+func splitWS(s string) []string {
+	return wsRE.Split(s, -1)
+}
+
+func (v *vendetta) gitSubmoduleAdd(loc repoLocation, dir string) error {
+	if !v.mutating() {
+		if v.DryRun && !v.subtreeMode() {
+			v.traceSkipped("git", v.cloneArgs(loc, dir)...)
+		}
+
+		v.addSubmodule(submodule{dir: dir, used: true, pending: true,
+			url: loc.url, branch: loc.branch, major: loc.major,
+			subtree: v.subtreeMode()})
+		return nil
+	}
+
+	if v.subtreeMode() {
+		return v.gitSubtreeAdd(loc, dir)
+	}
+
+	v.queueClone(loc, dir)
+	return nil
+}
+
+func (v *vendetta) git(args ...string) error {
+	return v.system("git", args...)
+}
+
+func (v *vendetta) system(name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := v.command(name, args...)
+	cmd.Stdout = v.Stdout
+	cmd.Stderr = io.MultiWriter(v.Stderr, &stderr)
+	if v.QuietGit {
+		cmd.Stdout = ioutil.Discard
+		cmd.Stderr = &stderr
+	}
+
+	v.traceStart(cmd)
+	start := time.Now()
+	err := cmd.Start()
+	if err == nil {
+		err = cmd.Wait()
+		v.commandTime(name, start)
+	}
+
+	v.traceDone(cmd, err)
+	if err == nil {
+		return nil
+	}
+
+	v.showQuietStderr(stderr.Bytes())
+	return commandFailed(cmd.Args, stderr.String(), err)
+}
+
+// With -quiet-git, the stderr output of commands is only shown if
+// they fail.
+func (v *vendetta) showQuietStderr(stderr []byte) {
+	if v.QuietGit {
+		v.Stderr.Write(stderr)
+	}
+}
+
+// The maximum length of a line of output read from a command
+const maxOutputLine = 16 << 20
+
+type popenLines struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	*bufio.Scanner
+
+	v      *vendetta
+	start  time.Time
+	stderr bytes.Buffer
+}
+
+func (v *vendetta) popen(name string, args ...string) (*popenLines, error) {
+	cmd := v.command(name, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &popenLines{cmd: cmd, stdout: stdout, v: v, start: time.Now()}
+	cmd.Stderr = io.MultiWriter(v.Stderr, &p.stderr)
+	if v.QuietGit {
+		cmd.Stderr = &p.stderr
+	}
+
+	v.traceStart(cmd)
+	if err := cmd.Start(); err != nil {
+		v.traceDone(cmd, err)
+		return nil, err
+	}
+
+	// A line of output can be long, e.g. from 'git submodule
+	// status' with long paths, so allow well beyond the default
+	// 64KB limit of a Scanner.  The lines are just bytes, so
+	// output that isn't valid UTF-8 doesn't matter here.
+	p.Scanner = bufio.NewScanner(stdout)
+	p.Scanner.Buffer(make([]byte, 64*1024), maxOutputLine)
+	return p, nil
+}
+
+func (p *popenLines) close() error {
+	res := p.Scanner.Err()
+	if res == bufio.ErrTooLong && p.cmd != nil {
+		res = fmt.Errorf("A line of output from '%s' is longer than %d bytes",
+			strings.Join(p.cmd.Args, " "), maxOutputLine)
+	}
+	setRes := func(err error) {
+		if res == nil {
+			res = err
+		}
+	}
+
+	if p.stdout != nil {
+		_, err := io.Copy(ioutil.Discard, p.stdout)
+		p.stdout = nil
+		if err != nil {
+			setRes(err)
+			p.cmd.Process.Kill()
+		}
+	}
+
+	if p.cmd != nil {
+		err := p.cmd.Wait()
+		p.v.traceDone(p.cmd, err)
+		if err != nil {
+			p.v.showQuietStderr(p.stderr.Bytes())
+			setRes(commandFailed(p.cmd.Args, p.stderr.String(), err))
+		}
+
+		p.v.commandTime(p.cmd.Path, p.start)
+		p.cmd = nil
+	}
+
+	return res
+}
+
+// Account for the time taken by a command, for the stats.
+func (v *vendetta) commandTime(name string, start time.Time) {
+	if filepath.Base(name) != "git" {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.gitTime += time.Since(start)
+}
+
+func (v *vendetta) realDir(dir string) string {
+	res := filepath.Join(v.rootDir, dir)
+	if res == "" {
+		res = "."
+	}
+
+	return res
+}
+
+type rootPackage struct {
+	dir string
+	*build.Package
+}
+
+func (v *vendetta) scanRootProject() ([]rootPackage, error) {
+	if v.Incremental {
+		return v.scanChangedDirs()
+	}
+
+	return v.scanProject(v.scanDir, v.scanDir == "")
+}
+
+// Scan the packages under top, which is a directory of the project
+// (or one of the extra roots).  If root is set, top is the top level
+// of its repo, so its vendor directory holds dependencies rather than
+// packages of the project.
+func (v *vendetta) scanProject(top string, root bool) ([]rootPackage, error) {
+	// Load each package in the root project without resolving
+	// dependencies, because we process packages in the root
+	// project slightly differently to dependency packages.
+	var pkgs []rootPackage
+	var err error
+
+	var traverseDir func(dir string, root bool)
+	traverseDir = func(dir string, root bool) {
+		var pkg *build.Package
+		pkg, err = v.loadRootPackage(dir)
+		if err != nil {
+			return
+		}
+
+		if pkg != nil {
+			pkgs = append(pkgs, rootPackage{dir, pkg})
+		}
+
+		// An error from a subdirectory stops readDir, and
+		// must not be overwritten by its nil result.
+		rerr := readDir(v.realDir(dir), func(fi os.FileInfo) bool {
+			// Symlinks are not followed, which also means
+			// that a vendor directory is skipped even if
+			// it is a symlink.  In worktrees and
+			// submodules, .git is a file rather than a
+			// directory, so gets skipped here too.
+			if !fi.IsDir() || v.skipProjectDir(fi.Name(), root) {
+				return true
+			}
+
+			traverseDir(filepath.Join(dir, fi.Name()), false)
+			return err == nil
+		})
+		if err == nil {
+			err = rerr
+		}
+	}
+
+	traverseDir(top, root)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkgs, nil
+}
+
+// Load a package of the project in dir, returning nil if there is
+// none.
+func (v *vendetta) loadRootPackage(dir string) (*build.Package, error) {
+	pkg, err := v.loadPackage(dir, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the imports of files excluded by build constraints, for
+	// -tools and -include-ignored.
+	var extraImports func(string) (string, []string, []string, error)
+	switch {
+	case v.IncludeIgnored:
+		extraImports = v.ignoredImports
+	case v.Tools:
+		extraImports = v.toolImports
+	}
+
+	if extraImports != nil {
+		name, imports, testImports, err := extraImports(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		// The imports of test files are only resolved along
+		// with those of the tests of the package.
+		if len(imports) > 0 || len(testImports) > 0 {
+			if pkg == nil {
+				pkg = &build.Package{
+					Dir:  v.realDir(dir),
+					Name: name,
+				}
+			}
+
+			pkg.Imports = unionStrings(pkg.Imports, imports)
+			pkg.TestImports = unionStrings(pkg.TestImports,
+				testImports)
+		}
+	}
+
+	if pkg != nil {
+		v.markProcessed(dir)
+	}
+
+	return pkg, nil
+}
+
+// Should a subdirectory with the given name be skipped when scanning
+// the project?  root is set if its parent is the top level of the
+// repo.
+func (v *vendetta) skipProjectDir(name string, root bool) bool {
+	// Like the go tool, skip directories whose names begin with
+	// '.'.  This only applies to subdirectories, so the starting
+	// directory is always scanned.  Even with -hidden, the .git
+	// directory never holds packages.
+	if strings.HasPrefix(name, ".") && (!v.Hidden || name == ".git") {
+		return true
+	}
+
+	switch name {
+	case "vendor":
+		// The top-level vendor directory is where dependencies
+		// go.
+		return root
+	}
+
+	for _, skip := range v.SkipDirs {
+		if name == skip {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *vendetta) resolveRootProjectDeps(pkgs []rootPackage) error {
+	for _, pkg := range pkgs {
+		if err := v.resolveDependencies(pkg.dir, pkg.Imports); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Resolve the test imports of the packages in the root project.  Test
+// imports are only considered for packages in the root project, never
+// for dependencies.  This is done once everything else needed by the
+// project has been resolved (and cloned), so that the submodules
+// first used here are those only needed by the tests, and they get
+// marked as such.
+func (v *vendetta) resolveRootTestDeps(pkgs []rootPackage) error {
+	if v.NoTests {
+		return nil
+	}
+
+	// When not making changes, the packages in submodules that
+	// would be added can't be scanned, so we don't know all that
+	// the project needs outside of its tests.
+	v.mu.Lock()
+	used := make(map[string]bool)
+	known := true
+	for _, sm := range v.submodules {
+		used[sm.dir] = sm.used
+		if sm.used && sm.pending {
+			known = false
+		}
+	}
+	v.mu.Unlock()
+
+	for _, pkg := range pkgs {
+		if err := v.resolveDependencies(pkg.dir, pkg.TestImports); err != nil {
+			return err
+		}
+		if err := v.resolveDependencies(pkg.dir, pkg.XTestImports); err != nil {
+			return err
+		}
+	}
+
+	if err := v.finishClones(); err != nil {
+		return err
+	}
+
+	if !known {
+		return nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := range v.submodules {
+		sm := &v.submodules[i]
+		sm.testOnly = sm.used && !used[sm.dir]
+	}
+
+	return nil
+}
+
+// Is dir within a vendor directory?
+func inVendorDir(dir string) bool {
+	for _, elem := range strings.Split(dir, string(os.PathSeparator)) {
+		if elem == "vendor" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mainOnly(pkgs []rootPackage) bool {
+	for _, pkg := range pkgs {
+		if pkg.Name != "main" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Mark dir as processed, returning false if it already was.
+func (v *vendetta) markProcessed(dir string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, found := v.processedDirs[dir]; found {
+		return false
+	}
+
+	v.processedDirs[dir] = struct{}{}
+	return true
+}
+
+// Get the package previously loaded from dir.  This can return nil
+// if the package is still being loaded by another goroutine.
+func (v *vendetta) loadedPackage(dir string) *build.Package {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.dirPackages[dir]
+}
+
+func (v *vendetta) scanPackage(dir string) (*build.Package, error) {
+	if !v.markProcessed(dir) {
+		return v.loadedPackage(dir), nil
+	}
+
+	pkg, err := v.loadPackage(dir, false)
+	if err != nil || pkg == nil {
+		return nil, err
+	}
+
+	// With -no-recurse-deps, we don't resolve the imports of
+	// vendored packages.  Note that this is not the same as
+	// skipping the package: it has already been found or added
+	// by the time we get here.  It is only the dependencies of
+	// the package that get left out.  Packages in the project
+	// still get their imports resolved.
+	if v.NoRecurseDeps && inVendorDir(dir) {
+		return pkg, nil
+	}
+
+	if err = v.resolveDependencies(dir, pkg.Imports); err != nil {
+		return nil, err
+	}
+
+	return pkg, nil
+}
+
+func (v *vendetta) loadPackage(dir string, noGoOk bool) (*build.Package, error) {
+	pkg, err := v.buildContext.ImportDir(v.realDir(dir),
+		build.ImportComment)
+	if v.Exhaustive {
+		pkg, err = v.loadExhaustive(dir, pkg, err)
+	} else {
+		pkg, err = v.loadToggledCgo(dir, pkg, err)
+	}
+
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); ok && noGoOk {
+			return nil, nil
+		}
+
+		return nil, v.loadFailed(dir, noGoOk, err)
+	}
+
+	v.mu.Lock()
+	v.dirPackages[dir] = pkg
+	v.mu.Unlock()
+	return pkg, nil
+}
+
+// Deal with a package that couldn't be loaded, returning nil if the
+// run should carry on without it.  In directories of the project
+// (inProject), this is only worth a warning unless -strict is given:
+// they may be test fixtures and the like that nothing imports, and if
+// they are needed, the build will complain anyway.
+func (v *vendetta) loadFailed(dir string, inProject bool, err error) error {
+	lerr := &PackageLoadError{Dir: v.realDir(dir), Err: err}
+	switch {
+	case inProject && !v.Strict:
+		fmt.Fprintf(v.Stdout, "Warning: %s\n", lerr)
+	case v.KeepGoing:
+		v.keepGoing(lerr)
+	default:
+		return lerr
+	}
+
+	return nil
+}
+
+// With -keep-going, report an error and carry on, remembering to
+// fail at the end of the run.
+func (v *vendetta) keepGoing(err error) {
+	fmt.Fprintln(v.Stderr, err)
+	v.mu.Lock()
+	v.failures++
+	v.mu.Unlock()
+}
+
+func (v *vendetta) resolveDependencies(dir string, deps []string) error {
+	for _, dep := range deps {
+		if err := v.resolveDependency(dir, dep); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *vendetta) resolveDependency(dir string, pkg string) error {
+	v.mu.Lock()
+	v.resolvedPkgs[pkg] = struct{}{}
+	v.mu.Unlock()
+
+	if err := v.resolveImport(dir, pkg); err != nil {
+		return v.importedBy(err, pkg, dir)
+	}
+
+	return nil
+}
+
+func (v *vendetta) importedBy(err error, pkg, dir string) error {
+	if ie, ok := err.(*UnresolvableImportError); ok {
+		ie.ImportedBy = append(ie.ImportedBy, v.realDir(dir))
+		return ie
+	}
+
+	return &UnresolvableImportError{Path: pkg,
+		ImportedBy: []string{v.realDir(dir)}, Err: err}
+}
+
+func (v *vendetta) resolveImport(dir string, pkg string) error {
+	found, pkgdir, err := v.searchGoPath(dir, pkg)
+	switch {
+	case err != nil:
+		return err
+	case found:
+		// Does the package fall within an existing submodule
+		// under vendor/ ?
+		if sm, ok := v.useSubmodule(pkgdir); ok && v.Update {
+			if v.mutating() {
+				err = v.updateSubmodule(&sm)
+			} else if v.DryRun {
+				err = v.previewUpdate(&sm)
+			}
+
+			if err != nil {
+				if err = v.updateFailed(&sm, err); err != nil {
+					return err
+				}
+			}
+		}
+
+	default:
+		pkgdir, err = v.obtainPackage(pkg)
+		if err != nil {
+			return err
+		}
+
+		if pkgdir == "" {
+			// A submodule may still be pending for it
+			v.markDirect(dir, filepath.Join("vendor",
+				packageToPath(pkg)))
+			return nil
+		}
+	}
+
+	v.markDirect(dir, pkgdir)
+
+	if v.deferScan(dir, pkg, pkgdir) {
+		return nil
+	}
+
+	pi, err := v.scanPackage(pkgdir)
+	if err != nil {
+		return err
+	}
+
+	v.checkImportComment(pi, pkg, dir)
+	return nil
+}
+
+// Warn if a package was imported by a path other than the one in its
+// import comment.
+func (v *vendetta) checkImportComment(pi *build.Package, pkg, dir string) {
+	if pi != nil && pi.ImportComment != "" && pkg != pi.ImportComment {
+		fmt.Fprintf(v.Stdout, "Warning: Package with import comment %s referred to as %s (from directory %s)\n",
+			pi.ImportComment, pkg, v.realDir(dir))
+	}
+}
+
+func (v *vendetta) obtainPackage(pkg string) (string, error) {
+	bits := strings.Split(pkg, "/")
+
+	// Exclude golang standard packages
+	if !strings.Contains(bits[0], ".") {
+		// "C" is the pseudo-package for cgo
+		if v.AllowDotlessModules && pkg != "C" && !v.inGoroot(pkg) {
+			return "", fmt.Errorf("Package %s is not in the standard library, and its import path has no dot in the first element, so it can't be obtained; it may be a local module that is missing", pkg)
+		}
+
+		if v.ShowStdlib && pkg != "C" {
+			v.showStdlib(pkg)
+		}
+
+		return "", nil
+	}
+
+	// Excluded packages are used if they are present, but we
+	// don't try to obtain them.
+	if v.excluded(pkg) {
+		return "", nil
+	}
+
+	// Packages that should be in the project must not be added
+	// as dependencies.
+	if prefix := v.overlappingProject(pkg); prefix != "" {
+		return "", fmt.Errorf("Package %s is not present in the project %s", pkg, prefix)
+	}
+
+	// A submodule we would have added, or that is waiting to be
+	// cloned, may already cover this package.  When not making
+	// changes, it won't be present, so we can't go on to scan the
+	// package.
+	pkgdir := filepath.Join("vendor", packageToPath(pkg))
+	if sm, ok := v.pathInSubmodule(pkgdir); ok && sm.pending {
+		if !v.mutating() {
+			return v.existingPackage(pkgdir), nil
+		}
+
+		return pkgdir, nil
+	}
+
+	if v.Offline {
+		return "", fmt.Errorf("Package %s is not vendored, and obtaining it would require network access", pkg)
+	}
+
+	// If go.mod replaces the module, look up the repo of the
+	// replacement instead, but still place it according to the
+	// original import path.
+	lookup := pkg
+	rep, replaced := v.replacement(pkg)
+	if replaced {
+		lookup = rep.new + pkg[len(rep.old):]
+		bits = strings.Split(lookup, "/")
+	}
+
+	// Figure out how to obtain the package.  Packages on the
+	// well-known hosts in hostingSites (such as github.com, where
+	// most of them live) are treated as a special case.
+	// Otherwise, we use the queryRepoRoot code borrowed from
+	// vcs.go to figure out how to obtain the package.
+	// Host names are case-insensitive, but the rest of the
+	// import path may be case-sensitive, and the package will be
+	// placed according to the import path as written.
+	host := strings.ToLower(bits[0])
+
+	// Rules from the config file take precedence over
+	// hostingSites.
+	var loc repoLocation
+	site := v.matchRule(bits)
+	if site == nil {
+		site = hostingSite(host)
+	}
+
+	if site != nil {
+		var err error
+		if loc, err = site(bits); err == errUseMetaTags {
+			site = nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	// For private packages, avoid leaking the import path to
+	// public go-get endpoints by guessing the repo, to be cloned
+	// over SSH, unless a config rule covers it.
+	private := v.private(lookup)
+	if site == nil && private {
+		if len(bits) < 3 {
+			return "", fmt.Errorf("Package %s is private (according to GOPRIVATE), so its repo can't be looked up; add a rule for it to %s", pkg, configFile)
+		}
+
+		loc.root = strings.Join(bits[:3], "/")
+		loc.url = fmt.Sprintf("git@%s:%s.git", bits[0],
+			strings.Join(bits[1:3], "/"))
+		fmt.Fprintf(v.Stdout, "Warning: package '%s' is private, so not querying go-import meta tags. Guessing git repo URL '%s'\n", pkg, loc.url)
+	} else if site == nil {
+		if rr, err := queryRepoRoot(lookup, secure); err == nil {
+			if rr.vcs != "git" {
+				return "", &UnsupportedVCSError{Package: pkg,
+					VCS: rr.vcs, Repo: rr.repo}
+			}
+
+			loc = repoLocation{root: rr.root, url: rr.repo}
+		} else if strings.HasSuffix(err.Error(), "no go-import meta tags") && len(bits) >= 3 {
+			// When no go-import meta tag is found, guess
+			// the base package and repo URL, so that
+			// e.g. package names on gitlab work.  The
+			// test above is gross, but it avoids changes
+			// to the borrowed reporoot code.
+			loc.root = strings.Join(bits[:3], "/")
+			loc.url = fmt.Sprintf("https://%s.git", loc.root)
+			fmt.Fprintf(v.Stdout, "Warning: no go-import meta tags found for package '%s'. Guessing git repo URL '%s'\n", pkg, loc.url)
+		} else {
+			return "", err
+		}
+	}
+
+	if host == "gopkg.in" && v.GopkgInUpstream && !private {
+		loc = v.gopkgInUpstreamRepo(loc)
+	}
+
+	if v.DetectMoved && !private {
+		loc = v.checkMoved(loc)
+	}
+
+	if replaced {
+		if !isSubpackage(loc.root, rep.new) {
+			return "", fmt.Errorf("Package %s is replaced by %s in go.mod, but %s is not at the root of the repo %s", pkg, rep.new, rep.new, loc.url)
+		}
+
+		loc.root = rep.old + loc.root[len(rep.new):]
+	}
+
+	loc.major = majorSuffix(pkg, loc.root)
+	if v.GoProxy && !private && loc.branch == "" && loc.tag == "" {
+		v.proxyVersion(&loc)
+	}
+
+	v.selectBranch(&loc)
+
+	if sm := v.submoduleOutsideVendor(loc.root); sm != nil {
+		fmt.Fprintf(v.Stdout, "Warning: package %s seems to be provided by the submodule %s, which is outside vendor/ so the go tool will not find it there\n",
+			pkg, sm.dir)
+	}
+
+	if err := v.checkHostAllowed(pkg, loc.url); err != nil {
+		return "", err
+	}
+
+	projDir := filepath.Join("vendor", packageToPath(loc.root))
+
+	// If an existing submodule already covers the directory (e.g.
+	// because it was cloned from a repo whose root is further up
+	// the import path), git would refuse to add another submodule
+	// inside it.  The package has to come from that submodule, so
+	// it gets scanned there.
+	if sm, ok := v.pathInSubmodule(projDir); ok {
+		v.useSubmodule(sm.dir)
+		pkgdir := filepath.Join("vendor", packageToPath(pkg))
+		found, err := v.hasGoFiles(pkgdir)
+		if err != nil {
+			return "", err
+		}
+
+		if !found {
+			return "", fmt.Errorf("Package %s should be provided by the submodule %s, but is not present there (not adding a nested submodule at %s)",
+				pkg, sm.dir, projDir)
+		}
+
+		return pkgdir, nil
+	}
+
+	// A repo can be reachable through more than one import path
+	// (e.g. a vanity import path and the path on its hosting
+	// site).  Don't add a second copy of it.
+	if sm := v.useSubmoduleWithURL(loc.url, loc.major); sm != nil {
+		fmt.Fprintf(v.Stdout, "Warning: package %s is in the repo %s, which is already present at %s; not adding it again at %s\n",
+			pkg, loc.url, sm.dir, projDir)
+		return "", nil
+	}
+
+	// A copy of the repo for another major version of the module
+	// may have been moved into a vN directory under projDir, and
+	// git can't add a submodule around it.
+	if sm, ok := v.submoduleWithin(projDir); ok {
+		return "", fmt.Errorf("Package %s is in the repo %s, but it can't be added at %s because the submodule %s is inside that directory",
+			pkg, loc.url, projDir, sm.dir)
+	}
+
+	if err := v.gitSubmoduleAdd(loc, projDir); err != nil {
+		return "", err
+	}
+
+	if !v.mutating() {
+		return v.existingPackage(pkgdir), nil
+	}
+
+	return pkgdir, nil
+}
+
+// When not making changes, a package in a pending submodule can't
+// usually be scanned.  But with -ignore-existing, the submodule may
+// really be there, so its packages can be scanned to find the
+// transitive dependencies.  Return pkgdir if so, otherwise "".
+func (v *vendetta) existingPackage(pkgdir string) string {
+	if !v.IgnoreExisting {
+		return ""
+	}
+
+	if fi, err := os.Stat(v.realDir(pkgdir)); err != nil || !fi.IsDir() {
+		return ""
+	}
+
+	return pkgdir
+}
+
+// With -show-stdlib, report a package that we treat as part of the
+// standard library because its import path has no dot in the first
+// element, and check that it really is in GOROOT.
+func (v *vendetta) showStdlib(pkg string) {
+	v.mu.Lock()
+	_, seen := v.stdlibPkgs[pkg]
+	v.stdlibPkgs[pkg] = struct{}{}
+	v.mu.Unlock()
+	if seen {
+		return
+	}
+
+	if !v.inGoroot(pkg) {
+		fmt.Fprintf(v.Stdout, "Warning: package %s is treated as part of the standard library, but was not found in GOROOT\n", pkg)
+		return
+	}
+
+	fmt.Fprintf(v.Stderr, "Standard library package: %s\n", pkg)
+}
+
+// Is the package in GOROOT, i.e. part of the standard library?
+func (v *vendetta) inGoroot(pkg string) bool {
+	p, err := v.buildContext.Import(pkg, "", build.FindOnly)
+	return err == nil && p.Goroot
+}
+
+// Search the gopath for the given dir to find an existing package
+func (v *vendetta) searchGoPath(dir, pkg string) (bool, string, error) {
+	gp, err := v.getGoPath(dir)
+	if err != nil {
+		return false, "", err
+	}
+
+	for gp != nil {
+		found, pkgdir, err := gp.provides(pkg, v)
+		if err != nil {
+			return false, "", err
+		}
+
+		if found {
+			return found, pkgdir, nil
+		}
+
+		gp = gp.next
+	}
+
+	return false, "", nil
+}
+
+func (v *vendetta) getGoPath(dir string) (*goPath, error) {
+	v.mu.Lock()
+	gp := v.goPaths[dir]
+	v.mu.Unlock()
+	if gp != nil {
+		return gp, nil
+	}
+
+	gp, err := v.getGoPath(parentDir(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	// If there's a vendor/ dir here, we need to put it on the
+	// front of the gopath.  But a dependency under vendor/ may
+	// come with its own vendor/ dir.  Unless -nested-vendor is
+	// given, we skip it, so that the dependency's imports are
+	// resolved from the top-level vendor/ dir, rather than
+	// scanning copies of packages that get flattened there.
+	if !isSubpath(dir, "vendor") || v.NestedVendor {
+		vendorDir := filepath.Join(dir, "vendor")
+		fi, err := os.Stat(v.realDir(vendorDir))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+		} else if fi.IsDir() {
+			gp = &goPath{dir: vendorDir, next: gp}
+		}
+	}
+
+	v.mu.Lock()
+	v.goPaths[dir] = gp
+	v.mu.Unlock()
+	return gp, nil
+}
+
+func (gp *goPath) provides(pkg string, v *vendetta) (bool, string, error) {
+	// With -ignore-existing, pretend that nothing is vendored
+	if v.IgnoreExisting && inVendorDir(gp.dir) {
+		return false, "", nil
+	}
+
+	matched, pkg := gp.removePrefix(pkg)
+	if !matched {
+		return false, "", nil
+	}
+
+	// The root project's goPath has the empty dir, i.e. the top
+	// level of the repo, so the remainder of the import path is
+	// already the package's directory within the repo ("" for the
+	// root package itself).  It must stay that way: a package of
+	// the project that ended up with a path under vendor/ would get
+	// vendored.
+	pkgdir := packageToPath(pkg)
+	if gp.dir != "" {
+		pkgdir = filepath.Join(gp.dir, pkgdir)
+	}
+
+	found, err := v.hasGoFiles(pkgdir)
+	if err != nil || !found {
+		return false, "", err
+	}
+
+	return true, pkgdir, nil
+}
+
+// Does dir hold any Go source files?
+func (v *vendetta) hasGoFiles(dir string) (bool, error) {
+	foundGoSrc := false
+	if err := readDir(v.realDir(dir), func(fi os.FileInfo) bool {
+		// Should check for symlinks here?
+		if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), ".go") {
+			foundGoSrc = true
+			return false
+		}
+		return true
+	}); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return false, err
+	}
+
+	return foundGoSrc, nil
+}
+
+func (gp *goPath) removePrefix(pkg string) (bool, string) {
+	if gp.prefixes == nil {
+		return true, pkg
+	}
+
+	// Import paths always use '/', whatever the OS.  The
+	// remainder is relative to the top level of the repo, which
+	// is where the project's root goPath lives.  If several
+	// prefixes match, the longest one wins, so that the result
+	// doesn't depend on map iteration order.
+	matched, match := false, ""
+	for prefix := range gp.prefixes {
+		if isSubpackage(pkg, prefix) && len(prefix) >= len(match) {
+			matched, match = true, prefix
+		}
+	}
+
+	switch {
+	case !matched:
+		return false, ""
+	case pkg == match:
+		return true, ""
+	default:
+		return true, pkg[len(match)+1:]
+	}
+}
+
+// Convert a package name to a filesystem path.  Directories are kept
+// in the form of the host OS throughout, and are converted to use
+// '/' when they are passed to git as paths within the repo.
+func packageToPath(name string) string {
+	return filepath.FromSlash(name)
+}
+
+// Convert a filesystem path to a package name
+func pathToPackage(path string) string {
+	return filepath.ToSlash(path)
+}
+
+func readDir(dir string, f func(os.FileInfo) bool) error {
+	dh, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer dh.Close()
+
+	for {
+		fis, err := dh.Readdir(100)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		for _, fi := range fis {
+			if !f(fi) {
+				return nil
+			}
+		}
+	}
+}
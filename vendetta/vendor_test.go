@@ -0,0 +1,69 @@
+package vendetta
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Vendor example.com/a, whose repo has its own vendor directory
+// holding example.com/d, which it imports.
+func runNestedVendor(t *testing.T, nested bool) []string {
+	gitTestEnv(t)
+	tmp := t.TempDir()
+	url := func(name string) string {
+		return filepath.ToSlash(filepath.Join(tmp, name))
+	}
+
+	makeGitRepo(t, filepath.Join(tmp, "a"), map[string]string{
+		"a.go":                      "package a\n\nimport _ \"example.com/d\"\n",
+		"vendor/example.com/d/d.go": "package d\n",
+	})
+	makeGitRepo(t, filepath.Join(tmp, "d"), map[string]string{
+		"d.go": "package d\n",
+	})
+
+	proj := filepath.Join(tmp, "proj")
+	makeGitRepo(t, proj, map[string]string{
+		"main.go": "package main\n\nimport (\n\t_ \"example.com/a\"\n\t_ \"example.com/proj/sub\"\n)\n\nfunc main() {}\n",
+		// The project's own nested vendor directories are
+		// always used.
+		"sub/sub.go":                    "package sub\n\nimport _ \"example.com/e\"\n",
+		"sub/vendor/example.com/e/e.go": "package e\n",
+		configFile: `{"rules": [
+			{"match": "^example\\.com/a$", "url": "` + url("a") + `", "rootSegments": 2},
+			{"match": "^example\\.com/d$", "url": "` + url("d") + `", "rootSegments": 2}]}`,
+	})
+
+	var out bytes.Buffer
+	res, err := Run(Options{
+		Root:         proj,
+		ProjectName:  "example.com/proj",
+		NestedVendor: nested,
+		Stdout:       &out,
+		Stderr:       &out,
+	})
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+
+	return res.Added
+}
+
+func TestNestedVendorSkipped(t *testing.T) {
+	want := []string{
+		filepath.Join("vendor", "example.com", "a"),
+		filepath.Join("vendor", "example.com", "d"),
+	}
+	if added := runNestedVendor(t, false); !reflect.DeepEqual(added, want) {
+		t.Errorf("added %v, want %v", added, want)
+	}
+}
+
+func TestNestedVendorUsed(t *testing.T) {
+	want := []string{filepath.Join("vendor", "example.com", "a")}
+	if added := runNestedVendor(t, true); !reflect.DeepEqual(added, want) {
+		t.Errorf("added %v, want %v", added, want)
+	}
+}
@@ -0,0 +1,104 @@
+package vendetta
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// With -vendor-repo, vendor/ is a git repo of its own (usually a
+// submodule of the project), and the dependency submodules belong to
+// it rather than to the project's repo.  Packages are still found
+// under vendor/ as usual, but the commands that add, update and
+// remove dependency submodules, and the .gitmodules file they use,
+// are those of the vendor repo.
+
+// The directory of the repo that holds the dependency submodules,
+// relative to the top level of the project's repo.
+func (v *vendetta) depsRepo() string {
+	if v.VendorRepo {
+		return "vendor"
+	}
+
+	return ""
+}
+
+// Make the arguments for a git command to be run in the repo that
+// holds the dependency submodules.
+func (v *vendetta) depsArgs(args ...string) []string {
+	if !v.VendorRepo {
+		return args
+	}
+
+	return append([]string{"-C", v.depsRepo()}, args...)
+}
+
+// Run a git command in the repo that holds the dependency submodules.
+func (v *vendetta) depsGit(args ...string) error {
+	return v.git(v.depsArgs(args...)...)
+}
+
+// Convert the directory of a dependency submodule to the path to give
+// to git commands run with depsGit.
+func (v *vendetta) depsPath(dir string) string {
+	if v.VendorRepo {
+		dir = strings.TrimPrefix(dir, v.depsRepo()+string(os.PathSeparator))
+	}
+
+	return filepath.ToSlash(dir)
+}
+
+// Check that vendor/ is a git repo, as -vendor-repo needs.
+func (v *vendetta) checkVendorRepo() error {
+	if !v.VendorRepo {
+		return nil
+	}
+
+	if v.subtreeMode() {
+		return usageErrorf("-vendor-repo adds dependencies as submodules of the vendor repo, so can't be combined with -mode subtree")
+	}
+
+	top, err := v.isRepoTopLevel(v.depsRepo())
+	if err != nil {
+		return err
+	}
+
+	if !top {
+		return usageErrorf("-vendor-repo needs %s to be a git repo (such as a submodule of the project) to add dependencies to",
+			v.realDir(v.depsRepo()))
+	}
+
+	return nil
+}
+
+// Is dir the top level of a git working tree?  Just having a .git
+// entry isn't enough to tell: it might be left over from something
+// else, or vendor/ might be a submodule that isn't checked out.  And
+// a directory within the project's own working tree doesn't count.
+func (v *vendetta) isRepoTopLevel(dir string) (bool, error) {
+	real, err := filepath.Abs(v.realDir(dir))
+	if err != nil {
+		return false, err
+	}
+
+	if real, err = filepath.EvalSymlinks(real); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	cmd := v.command("git", "-C", real, "rev-parse", "--show-toplevel")
+	v.traceStart(cmd)
+	out, err := cmd.Output()
+	v.traceDone(cmd, err)
+	if err != nil {
+		// Not inside a working tree at all
+		return false, nil
+	}
+
+	// git resolves symlinks in the path it reports, as we did
+	// above.
+	return filepath.FromSlash(strings.TrimSpace(string(out))) == real, nil
+}
@@ -0,0 +1,41 @@
+package vendetta
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsRepoTopLevel(t *testing.T) {
+	gitTestEnv(t)
+	proj := t.TempDir()
+	makeGitRepo(t, proj, map[string]string{
+		"main.go":       "package main\n",
+		"plain/x.go":    "package x\n",
+		"bogus/.git":    "gitdir: /nonexistent\n",
+		"vendor/README": "vendored\n",
+	})
+	runGit(t, filepath.Join(proj, "vendor"), "init", "-q")
+
+	v := &vendetta{Options: &Options{Stdout: ioutil.Discard,
+		Stderr: ioutil.Discard}, rootDir: proj}
+	for _, c := range []struct {
+		dir  string
+		want bool
+	}{
+		{"", true},
+		{"vendor", true},
+		{"plain", false},
+		{"bogus", false},
+		{"missing", false},
+	} {
+		got, err := v.isRepoTopLevel(c.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != c.want {
+			t.Errorf("isRepoTopLevel(%q) = %v, want %v", c.dir, got, c.want)
+		}
+	}
+}